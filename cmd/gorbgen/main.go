@@ -0,0 +1,99 @@
+// Command gorbgen generates gorb tagged Go structs from an existing database schema.
+//
+//	gorbgen -driver mysql -dsn "user:pwd@/db" -package model -child orders:order_line:order_id -o model.go [table ...]
+//
+// The SQLite driver is available when built with the sqlite tag.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/skolu/gorb"
+)
+
+type childFlags []*gorb.ChildMapping
+
+func (c *childFlags) String() string {
+	var mappings []string = make([]string, len(*c))
+	for i, cm := range *c {
+		mappings[i] = cm.Parent + ":" + cm.Child + ":" + cm.ForeignKey
+	}
+	return strings.Join(mappings, ",")
+}
+
+// Set parses parent:child[:fk_column]
+func (c *childFlags) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("Invalid child mapping %s, parent:child[:fk_column] expected", value)
+	}
+	cm := &gorb.ChildMapping{Parent: parts[0], Child: parts[1]}
+	if len(parts) == 3 {
+		cm.ForeignKey = parts[2]
+	}
+	*c = append(*c, cm)
+	return nil
+}
+
+func main() {
+	var driver, dsn, pkg, output string
+	var children childFlags
+	flag.StringVar(&driver, "driver", "mysql", "database driver: mysql or sqlite")
+	flag.StringVar(&dsn, "dsn", "", "data source name")
+	flag.StringVar(&pkg, "package", "main", "package name of generated file")
+	flag.StringVar(&output, "o", "", "output file, stdout if empty")
+	flag.Var(&children, "child", "child table mapping parent:child[:fk_column], can be repeated")
+	flag.Parse()
+
+	if len(dsn) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	e := run(driver, dsn, pkg, output, children, flag.Args())
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(1)
+	}
+}
+
+func run(driver, dsn, pkg, output string, children childFlags, tables []string) error {
+	var sqlDriver string
+	switch driver {
+	case "mysql":
+		sqlDriver = "mysql"
+	case "sqlite":
+		sqlDriver = "sqlite3"
+	default:
+		return fmt.Errorf("Unsupported driver %s", driver)
+	}
+	db, e := sql.Open(sqlDriver, dsn)
+	if e != nil {
+		return e
+	}
+	defer db.Close()
+
+	g := &gorb.StructGenerator{Package: pkg, Children: children}
+	if driver == "mysql" {
+		g.Driver = &gorb.MySqlSchemaUpgrader{Db: db}
+	} else {
+		g.Driver = &gorb.SqliteSchemaUpgrader{Db: db}
+	}
+
+	var w io.Writer = os.Stdout
+	if len(output) > 0 {
+		f, e := os.Create(output)
+		if e != nil {
+			return e
+		}
+		defer f.Close()
+		w = f
+	}
+	return g.Generate(w, tables...)
+}
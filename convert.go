@@ -1,6 +1,9 @@
 package gorb
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"math"
 	"reflect"
@@ -16,9 +19,103 @@ const (
 type (
 	gorbScanner struct {
 		ptr interface{}
+		// isJson unmarshals JSON documents into ptr
+		isJson bool
 	}
 )
 
+var (
+	scannerType reflect.Type = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  reflect.Type = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// isValuerType reports whether values of t can be scanned and bound by themselves
+func isValuerType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return reflect.PtrTo(t).Implements(scannerType) && reflect.PtrTo(t).Implements(valuerType)
+}
+
+// nullValueType returns the column type of sql.NullString like structs keeping the value
+// in the first field and whether it is set in Valid, Unsupported for other types
+func nullValueType(t reflect.Type) DataType {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t.NumField() != 2 || t.Field(1).Name != "Valid" || t.Field(1).Type.Kind() != reflect.Bool {
+		return Unsupported
+	}
+	return getPrimitiveDataType(t.Field(0).Type)
+}
+
+// valuerOf returns driver.Valuer of v, pointer receivers require v to be addressable
+func valuerOf(v reflect.Value) (driver.Valuer, bool) {
+	if v.Type().Implements(valuerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil, false
+		}
+		return v.Interface().(driver.Valuer), true
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(valuerType) {
+		return v.Addr().Interface().(driver.Valuer), true
+	}
+	return nil, false
+}
+
+// isJsonDocument is set for Json fields that are marshaled, string and []byte fields keep the raw document
+func (f *Field) isJsonDocument() bool {
+	if f.DataType != Json {
+		return false
+	}
+	var t reflect.Type = f.FieldType
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return !(t.Kind() == reflect.String || (t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8))
+}
+
+// marshalJsonDocument returns NULL for nil values of nullable fields, "null" document otherwise
+func marshalJsonDocument(v reflect.Value, isNullable bool) (interface{}, error) {
+	var isNil bool = (v.Kind() == reflect.Ptr || v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil()
+	if isNil && isNullable {
+		return nil, nil
+	}
+	b, e := json.Marshal(v.Interface())
+	if e != nil {
+		return nil, e
+	}
+	return string(b), nil
+}
+
+func scanJsonDocument(ptr interface{}, value interface{}) error {
+	v := reflect.ValueOf(ptr).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	switch src := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, ptr)
+	case string:
+		return json.Unmarshal([]byte(src), ptr)
+	}
+	return fmt.Errorf("Cannot convert to JSON document: %T", value)
+}
+
+// driverValue converts values decoded from JSON to the types sql.Scanner implementations expect
+func driverValue(value interface{}) interface{} {
+	if n, ok := value.(json.Number); ok {
+		if i64, e := n.Int64(); e == nil {
+			return i64
+		}
+		if f64, e := n.Float64(); e == nil {
+			return f64
+		}
+		return n.String()
+	}
+	return value
+}
+
 func isZeroDateStr(str string) bool {
 	var hasDigit = false
 	for _, r := range str {
@@ -74,6 +171,12 @@ func parseTime(value interface{}, dst *time.Time) (err error) {
 		*dst, err = parseDateTimeStr(v)
 	case int64:
 		*dst = time.Unix(v, 0)
+	case json.Number:
+		var sec int64
+		sec, err = v.Int64()
+		if err == nil {
+			*dst = time.Unix(sec, 0)
+		}
 	case uint64:
 		*dst = time.Unix(int64(v), 0)
 	default:
@@ -92,6 +195,9 @@ func parseString(value interface{}) (sVal string, err error) {
 		sVal = src
 	case []byte:
 		sVal = string(src)
+	case json.Number:
+		// JSON numbers are decoded with UseNumber, their text is kept
+		sVal = src.String()
 	default:
 		err = fmt.Errorf("Cannot convert to string: %v %T", src, src)
 	}
@@ -106,7 +212,7 @@ func parseBoolean(value interface{}) (bVal bool, err error) {
 	case nil:
 	case bool:
 		bVal = src
-	case uint64, int64, int, uint, uint32, int32, uint16, int16, uint8, int8:
+	case uint64, int64, int, uint, uint32, int32, uint16, int16, uint8, int8, json.Number:
 		var iVal int64
 		iVal, err = parseInt(value)
 		if err == nil {
@@ -148,6 +254,8 @@ func parseFloat(value interface{}) (fVal float64, err error) {
 		}
 	case string:
 		fVal, err = strconv.ParseFloat(src, 64)
+	case json.Number:
+		fVal, err = src.Float64()
 	case []byte:
 		fVal, err = strconv.ParseFloat(string(src), 64)
 	default:
@@ -191,6 +299,8 @@ func parseInt(value interface{}) (iVal int64, err error) {
 		iVal, err = strconv.ParseInt(src, 10, 64)
 	case []byte:
 		iVal, err = strconv.ParseInt(string(src), 10, 64)
+	case json.Number:
+		iVal, err = src.Int64()
 	case float64:
 		iVal = int64(round(src, 0))
 		if math.Abs(src-float64(iVal)) > 0.0000001 {
@@ -208,6 +318,14 @@ func parseInt(value interface{}) (iVal int64, err error) {
 	return
 }
 
+func parseIntRange(value interface{}, min int64, max int64) (iVal int64, err error) {
+	iVal, err = parseInt(value)
+	if err == nil && (iVal < min || iVal > max) {
+		err = fmt.Errorf("Value %d is out of range [%d, %d]", iVal, min, max)
+	}
+	return
+}
+
 func parseBlob(value interface{}) (blobVal []byte, err error) {
 	blobVal = nil
 	err = nil
@@ -227,6 +345,9 @@ func (gs *gorbScanner) Scan(value interface{}) (err error) {
 	var iVal int64
 
 	err = nil
+	if gs.isJson {
+		return scanJsonDocument(gs.ptr, value)
+	}
 	switch dst := gs.ptr.(type) {
 	case **time.Time:
 		if value == nil {
@@ -274,11 +395,11 @@ func (gs *gorbScanner) Scan(value interface{}) (err error) {
 			if *dst == nil {
 				*dst = new(int32)
 			}
-			iVal, err = parseInt(value)
+			iVal, err = parseIntRange(value, math.MinInt32, math.MaxInt32)
 			**dst = int32(iVal)
 		}
 	case *int32:
-		iVal, err = parseInt(value)
+		iVal, err = parseIntRange(value, math.MinInt32, math.MaxInt32)
 		*dst = int32(iVal)
 	case **uint32:
 		if value == nil {
@@ -287,12 +408,64 @@ func (gs *gorbScanner) Scan(value interface{}) (err error) {
 			if *dst == nil {
 				*dst = new(uint32)
 			}
-			iVal, err = parseInt(value)
+			iVal, err = parseIntRange(value, 0, math.MaxUint32)
 			**dst = uint32(iVal)
 		}
 	case *uint32:
-		iVal, err = parseInt(value)
+		iVal, err = parseIntRange(value, 0, math.MaxUint32)
 		*dst = uint32(iVal)
+	case **int16:
+		if value == nil {
+			*dst = nil
+		} else {
+			if *dst == nil {
+				*dst = new(int16)
+			}
+			iVal, err = parseIntRange(value, math.MinInt16, math.MaxInt16)
+			**dst = int16(iVal)
+		}
+	case *int16:
+		iVal, err = parseIntRange(value, math.MinInt16, math.MaxInt16)
+		*dst = int16(iVal)
+	case **uint16:
+		if value == nil {
+			*dst = nil
+		} else {
+			if *dst == nil {
+				*dst = new(uint16)
+			}
+			iVal, err = parseIntRange(value, 0, math.MaxUint16)
+			**dst = uint16(iVal)
+		}
+	case *uint16:
+		iVal, err = parseIntRange(value, 0, math.MaxUint16)
+		*dst = uint16(iVal)
+	case **int8:
+		if value == nil {
+			*dst = nil
+		} else {
+			if *dst == nil {
+				*dst = new(int8)
+			}
+			iVal, err = parseIntRange(value, math.MinInt8, math.MaxInt8)
+			**dst = int8(iVal)
+		}
+	case *int8:
+		iVal, err = parseIntRange(value, math.MinInt8, math.MaxInt8)
+		*dst = int8(iVal)
+	case **uint8:
+		if value == nil {
+			*dst = nil
+		} else {
+			if *dst == nil {
+				*dst = new(uint8)
+			}
+			iVal, err = parseIntRange(value, 0, math.MaxUint8)
+			**dst = uint8(iVal)
+		}
+	case *uint8:
+		iVal, err = parseIntRange(value, 0, math.MaxUint8)
+		*dst = uint8(iVal)
 	case **int:
 		if value == nil {
 			*dst = nil
@@ -370,6 +543,18 @@ func (gs *gorbScanner) Scan(value interface{}) (err error) {
 			*dst, err = parseString(value)
 		}
 
+	case **Fixed:
+		if value == nil {
+			*dst = nil
+		} else {
+			if *dst == nil {
+				*dst = new(Fixed)
+			}
+			err = (*dst).Scan(value)
+		}
+	case *Fixed:
+		err = dst.Scan(value)
+
 	case **[]byte:
 		if value == nil {
 			*dst = nil
@@ -388,25 +573,44 @@ func (gs *gorbScanner) Scan(value interface{}) (err error) {
 			*dst, err = parseBlob(value)
 		}
 
+	case sql.Scanner:
+		err = dst.Scan(driverValue(value))
+
 	default:
 		v := reflect.ValueOf(gs.ptr)
 		if v.Kind() == reflect.Ptr {
 			if !v.IsNil() {
 				v = v.Elem()
 				var k reflect.Kind = v.Kind()
+				if k == reflect.Ptr && v.Type().Implements(scannerType) {
+					if value == nil {
+						v.Set(reflect.Zero(v.Type()))
+						return nil
+					}
+					if v.IsNil() {
+						v.Set(reflect.New(v.Type().Elem()))
+					}
+					return v.Interface().(sql.Scanner).Scan(driverValue(value))
+				}
 				switch k {
-				case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16:
+				case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
 					{
 						iVal, err = parseInt(value)
 						if err == nil {
+							if v.OverflowInt(iVal) {
+								return fmt.Errorf("Value %d overflows %s", iVal, v.Type())
+							}
 							v.SetInt(iVal)
 							return nil
 						}
 					}
-				case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16:
+				case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
 					{
 						iVal, err = parseInt(value)
 						if err == nil {
+							if iVal < 0 || v.OverflowUint(uint64(iVal)) {
+								return fmt.Errorf("Value %d overflows %s", iVal, v.Type())
+							}
 							v.SetUint(uint64(iVal))
 							return nil
 						}
@@ -0,0 +1,113 @@
+package gorb
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	// Dialect renders the database specific parts of the DML generated by GorbManager.
+	// It has to be set before GorbManager.SetDB prepares the statements.
+	Dialect interface {
+		// Placeholder returns the bind parameter for 1-based position
+		Placeholder(position int) string
+		// QuoteIdentifier quotes table and column names
+		QuoteIdentifier(name string) string
+		// Paginate returns the clause appended to SELECT. Zero limit means no limit
+		Paginate(limit, offset uint32) string
+		// HasLastInsertId reports whether sql.Result.LastInsertId returns serial keys
+		HasLastInsertId() bool
+		// Returning returns the clause appended to INSERT to get the serial key back
+		Returning(column string) string
+	}
+
+	MySqlDialect    struct{}
+	PostgresDialect struct{}
+	SqliteDialect   struct{}
+)
+
+func (d MySqlDialect) Placeholder(position int) string {
+	return "?"
+}
+
+func (d MySqlDialect) QuoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func (d MySqlDialect) Paginate(limit, offset uint32) string {
+	if limit > 0 {
+		if offset > 0 {
+			return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+		}
+		return fmt.Sprintf(" LIMIT %d", limit)
+	}
+	if offset > 0 {
+		// MySQL has no OFFSET without LIMIT
+		return fmt.Sprintf(" LIMIT 18446744073709551615 OFFSET %d", offset)
+	}
+	return ""
+}
+
+func (d MySqlDialect) HasLastInsertId() bool {
+	return true
+}
+
+func (d MySqlDialect) Returning(column string) string {
+	return ""
+}
+
+func (d PostgresDialect) Placeholder(position int) string {
+	return fmt.Sprintf("$%d", position)
+}
+
+func (d PostgresDialect) QuoteIdentifier(name string) string {
+	return "\"" + strings.Replace(name, "\"", "\"\"", -1) + "\""
+}
+
+func (d PostgresDialect) Paginate(limit, offset uint32) string {
+	var clause string
+	if limit > 0 {
+		clause = fmt.Sprintf(" LIMIT %d", limit)
+	}
+	if offset > 0 {
+		clause += fmt.Sprintf(" OFFSET %d", offset)
+	}
+	return clause
+}
+
+func (d PostgresDialect) HasLastInsertId() bool {
+	return false
+}
+
+func (d PostgresDialect) Returning(column string) string {
+	return " RETURNING " + d.QuoteIdentifier(column)
+}
+
+func (d SqliteDialect) Placeholder(position int) string {
+	return "?"
+}
+
+func (d SqliteDialect) QuoteIdentifier(name string) string {
+	return "\"" + strings.Replace(name, "\"", "\"\"", -1) + "\""
+}
+
+func (d SqliteDialect) Paginate(limit, offset uint32) string {
+	if limit > 0 {
+		if offset > 0 {
+			return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+		}
+		return fmt.Sprintf(" LIMIT %d", limit)
+	}
+	if offset > 0 {
+		return fmt.Sprintf(" LIMIT -1 OFFSET %d", offset)
+	}
+	return ""
+}
+
+func (d SqliteDialect) HasLastInsertId() bool {
+	return true
+}
+
+func (d SqliteDialect) Returning(column string) string {
+	return ""
+}
@@ -0,0 +1,155 @@
+package gorb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type (
+	dlOrder struct {
+		Id    int64         `gorb:"id,pk"`
+		Name  string        `gorb:"name,:40"`
+		Lines []*dlLineItem `gorb:"order_line"`
+	}
+	dlLineItem struct {
+		Id      int64         `gorb:"id,pk"`
+		OrderId int64         `gorb:"order_id,fk"`
+		Sku     string        `gorb:"sku,:20"`
+		Notes   []*dlLineNote `gorb:"order_line_note"`
+	}
+	dlLineNote struct {
+		LineId int64        `gorb:"line_id,fk"`
+		Id     int64        `gorb:"id,pk"`
+		Text   string       `gorb:"text"`
+		Tags   []*dlNoteTag `gorb:"order_note_tag"`
+	}
+	dlNoteTag struct {
+		Id     int64  `gorb:"id,pk"`
+		NoteId int64  `gorb:"note_id,fk"`
+		Tag    string `gorb:"tag,:20"`
+	}
+
+	// dlDriver is a database/sql driver whose statements affect dlRowsAffected rows
+	dlDriver struct{}
+	dlConn   struct{}
+	dlStmt   struct{}
+)
+
+var dlRowsAffected int64
+
+func init() {
+	sql.Register("gorb_dl", dlDriver{})
+}
+
+func (d dlDriver) Open(name string) (driver.Conn, error) {
+	return dlConn{}, nil
+}
+
+func (c dlConn) Prepare(query string) (driver.Stmt, error) {
+	return dlStmt{}, nil
+}
+
+func (c dlConn) Close() error {
+	return nil
+}
+
+func (c dlConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("Transactions are not supported")
+}
+
+func (s dlStmt) Close() error {
+	return nil
+}
+
+func (s dlStmt) NumInput() int {
+	return -1
+}
+
+func (s dlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(dlRowsAffected), nil
+}
+
+func (s dlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, fmt.Errorf("Queries are not supported")
+}
+
+func TestDialectQueries(t *testing.T) {
+	var m GorbManager
+	ent, err := m.RegisterEntity(reflect.TypeOf(dlOrder{}), "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pg PostgresDialect
+	if q := ent.getInsertQuery(pg); q != `INSERT INTO "orders"("name") VALUES ($1) RETURNING "id"` {
+		t.Error(q)
+	}
+	if q := ent.getUpdateQuery(pg); q != `UPDATE "orders" SET "name"=$1 WHERE "id"=$2` {
+		t.Error(q)
+	}
+	if q := ent.Children[0].getInsertQuery(pg); q != `INSERT INTO "order_line"("order_id", "sku") VALUES ($1, $2) RETURNING "id"` {
+		t.Error(q)
+	}
+
+	var my MySqlDialect
+	if q := ent.getSelectQuery(my); q != "SELECT `id`, `name` FROM `orders` WHERE `id` = ?" {
+		t.Error(q)
+	}
+
+	rq, err := m.QueryForType(reflect.TypeOf(dlOrder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, _ := rq.NewWhereCriteria("Name", OpLike, "a%")
+	c2, _ := rq.NewWhereCriteria("id", OpGreater, 10)
+	rq.Where(c1)
+	rq.WhereClause.Or(c2)
+	where, params := rq.WhereClause.createWhereClause(pg, 1)
+	if where != `("name" LIKE $1) OR ("id" > $2)` || len(params) != 2 {
+		t.Error(where)
+	}
+
+	if p := pg.Paginate(10, 20); p != " LIMIT 10 OFFSET 20" {
+		t.Error(p)
+	}
+	if p := (SqliteDialect{}).Paginate(0, 5); p != " LIMIT -1 OFFSET 5" {
+		t.Error(p)
+	}
+
+	note := ent.Children[0].Children[0]
+	if q := note.getUpdateQuery(pg); q != `UPDATE "order_line_note" SET "line_id"=$1, "text"=$2 WHERE "id"=$3` {
+		t.Error(q)
+	}
+	tablePath := []*ChildTable{ent.Children[0], note}
+	if q := note.Children[0].getDeleteQuery(pg, tablePath); q != `DELETE FROM "order_note_tag" WHERE "note_id" IN (`+
+		`SELECT "id" FROM "order_line_note" WHERE "line_id" IN (SELECT "id" FROM "order_line" WHERE "order_id" = $1))` {
+		t.Error(q)
+	}
+}
+
+func TestStoreRowAffected(t *testing.T) {
+	var m GorbManager
+	ent, err := m.RegisterEntity(reflect.TypeOf(dlOrder{}), "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("gorb_dl", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ent.stmts = new(tableStmts)
+	ent.stmts.stmtUpdate, err = db.Prepare(ent.getUpdateQuery(MySqlDialect{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the error is returned before the row is logged
+	dlRowsAffected = 2
+	if err = ent.storeRow(nil, reflect.ValueOf(dlOrder{Id: 1}), nil); err == nil {
+		t.Error("more than one affected row accepted")
+	}
+}
@@ -1,14 +1,59 @@
 package gorb
 
 import (
+	"database/sql"
 	"fmt"
 	"reflect"
 )
 
+// cloneValuer copies a sql.Scanner field through its driver value, so reference types are not shared
+func cloneValuer(from, to reflect.Value) bool {
+	valuer, ok := valuerOf(from)
+	if !ok {
+		return false
+	}
+	value, e := valuer.Value()
+	if e != nil {
+		return false
+	}
+	var scanned reflect.Value = reflect.New(to.Type())
+	if scanned.Interface().(sql.Scanner).Scan(value) != nil {
+		return false
+	}
+	to.Set(scanned.Elem())
+	return true
+}
+
 func (t *Table) cloneInstance(from, to reflect.Value) {
 	for _, f := range t.Fields {
 		vFrom := from.FieldByIndex(f.ClassIdx)
 		vTo := to.FieldByIndex(f.ClassIdx)
+		if f.isJsonDocument() {
+			// maps and slices of the document are not shared
+			doc, e := marshalJsonDocument(vFrom, true)
+			if e == nil {
+				e = scanJsonDocument(vTo.Addr().Interface(), doc)
+			}
+			if e != nil {
+				vTo.Set(vFrom)
+			}
+			continue
+		}
+		if f.IsValuer {
+			if f.FieldType.Kind() == reflect.Ptr {
+				if vFrom.IsNil() {
+					vTo.Set(reflect.Zero(f.FieldType))
+					continue
+				}
+				vTo.Set(reflect.New(f.FieldType.Elem()))
+				vFrom, vTo = vFrom.Elem(), vTo.Elem()
+			}
+			if cloneValuer(vFrom, vTo) {
+				continue
+			}
+			vTo.Set(vFrom)
+			continue
+		}
 		if f.FieldType.Kind() == reflect.Ptr {
 			if vFrom.IsNil() {
 				vTo.Set(reflect.Zero(f.FieldType))
@@ -40,6 +85,13 @@ func (t *Table) cloneInstance(from, to reflect.Value) {
 					ch.cloneInstance(vChRowFrom.Elem(), vChRowTo.Elem())
 					vChTo.Set(reflect.Append(vChTo, vChRowTo))
 				}
+			case reflect.Map:
+				vChTo.Set(reflect.MakeMapWithSize(ch.ChildClass, vChFrom.Len()))
+				for _, key := range vChFrom.MapKeys() {
+					vChRowTo := reflect.New(ch.RowClass)
+					ch.cloneInstance(vChFrom.MapIndex(key).Elem(), vChRowTo.Elem())
+					vChTo.SetMapIndex(key, vChRowTo)
+				}
 			}
 		}
 	}
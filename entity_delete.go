@@ -50,7 +50,7 @@ func (conn *GorbManager) EntityDelete(eType reflect.Type, pk interface{}) error
 	var e error = nil
 	var txn *sql.Tx = nil
 
-	if len(ent.Children) > 0 {
+	if len(ent.Children) > 0 || len(ent.Relations) > 0 {
 		txn, e = conn.db.Begin()
 		if e != nil {
 			return e
@@ -59,6 +59,16 @@ func (conn *GorbManager) EntityDelete(eType reflect.Type, pk interface{}) error
 
 	var stmt *sql.Stmt
 
+	for _, rel := range ent.Relations {
+		stmt = txn.Stmt(rel.stmts.stmtDelete)
+		_, e = stmt.Exec(pk)
+		stmt.Close()
+		if e != nil {
+			txn.Rollback()
+			return e
+		}
+	}
+
 	chldns := ent.FlattenChildren()
 	for i := len(chldns) - 1; i >= 0; i-- {
 		child := chldns[i]
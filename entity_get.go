@@ -51,6 +51,7 @@ func (t *Table) populateChildren(row reflect.Value) error {
 				gs, ok := flds[i].(*gorbScanner)
 				if ok {
 					gs.ptr = pV
+					gs.isJson = f.isJsonDocument()
 				}
 			}
 			e = rows.Scan(flds...)
@@ -69,8 +70,7 @@ func (t *Table) populateChildren(row reflect.Value) error {
 				}
 			case reflect.Map:
 				{
-					childKey := childRow.FieldByIndex(childTable.PrimaryKey.ClassIdx)
-					childStorage.SetMapIndex(childKey, childRow.Addr())
+					childStorage.SetMapIndex(childTable.mapKey(childRow), childRow.Addr())
 				}
 			}
 
@@ -107,17 +107,41 @@ func (conn *GorbManager) EntityGet(object interface{}, pk interface{}) error {
 		return fmt.Errorf("Unsupported entity %s", eType.Name())
 	}
 
-	var e error
-	var flds []interface{} = make([]interface{}, len(ent.Fields))
-
 	rowValue := reflect.ValueOf(object)
 	if isPtr {
 		rowValue = rowValue.Elem()
 	}
+	return conn.entityGet(ent, rowValue, pk, false)
+}
+
+// entityGet reads the entity row with its children, references and relations.
+// Nested entities, related or referenced, are read without references and relations.
+func (conn *GorbManager) entityGet(ent *Entity, rowValue reflect.Value, pk interface{}, isNested bool) error {
+	e := ent.readRow(rowValue, pk)
+	if e != nil || isNested {
+		return e
+	}
+	e = ent.populateReferences(rowValue)
+	if e == nil && len(ent.Relations) > 0 {
+		var key rowKey
+		key, e = ent.getKey(rowValue)
+		if e == nil {
+			e = conn.populateRelations(ent, rowValue, key)
+		}
+	}
+	return e
+}
+
+// readRow reads the entity row and its child rows
+func (ent *Entity) readRow(rowValue reflect.Value, pk interface{}) error {
+	var e error
+	var flds []interface{} = make([]interface{}, len(ent.Fields))
+
 	for i, f := range ent.Fields {
 		pV := rowValue.FieldByIndex(f.ClassIdx).Addr().Interface()
 		var gs gorbScanner
 		gs.ptr = pV
+		gs.isJson = f.isJsonDocument()
 		flds[i] = &gs
 	}
 
@@ -1,11 +1,11 @@
 package gorb
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"math"
 	"reflect"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -16,9 +16,9 @@ func sameValue(value1, value2 reflect.Value) bool {
 	switch value1.Kind() {
 	case reflect.Bool:
 		return value1.Bool() == value2.Bool()
-	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return value1.Int() == value2.Int()
-	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		return value1.Uint() == value2.Uint()
 	case reflect.Float32, reflect.Float64:
 		return math.Abs(value1.Float()-value2.Float()) < 0.0000001
@@ -39,8 +39,18 @@ func sameValue(value1, value2 reflect.Value) bool {
 					return true
 				}
 			}
+			// JSON document
+			return reflect.DeepEqual(value1.Interface(), value2.Interface())
 		}
+	case reflect.Map:
+		return reflect.DeepEqual(value1.Interface(), value2.Interface())
 	default:
+		var dc1, dc2 Fixed
+		dc1, ok = value1.Interface().(Fixed)
+		if ok {
+			dc2, ok = value2.Interface().(Fixed)
+			return ok && dc1.Equal(dc2)
+		}
 		var d1, d2 time.Time
 		d1, ok = value1.Interface().(time.Time)
 		if ok {
@@ -49,10 +59,48 @@ func sameValue(value1, value2 reflect.Value) bool {
 				return d1.Unix() == d2.Unix()
 			}
 		}
+		v1, ok1 := valuerOf(value1)
+		v2, ok2 := valuerOf(value2)
+		if ok1 && ok2 {
+			dv1, e1 := v1.Value()
+			dv2, e2 := v2.Value()
+			return e1 == nil && e2 == nil && reflect.DeepEqual(dv1, dv2)
+		}
+		if value1.Kind() == reflect.Struct {
+			return reflect.DeepEqual(value1.Interface(), value2.Interface())
+		}
 	}
 	return false
 }
 
+// jsonValuer returns the value of a sql.Scanner field that is serialized to JSON.
+// Types without json.Marshaler are serialized as their driver value, so they can be scanned back.
+func jsonValuer(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if _, ok := v.Interface().(json.Marshaler); ok {
+		return v.Interface()
+	}
+	if v.CanAddr() {
+		if _, ok := v.Addr().Interface().(json.Marshaler); ok {
+			return v.Addr().Interface()
+		}
+	}
+	valuer, ok := valuerOf(v)
+	if !ok {
+		return v.Interface()
+	}
+	dv, e := valuer.Value()
+	if e != nil {
+		return v.Interface()
+	}
+	if b, ok := dv.([]byte); ok {
+		return string(b)
+	}
+	return dv
+}
+
 func (t *Table) marshalToJson(newRow reflect.Value, oldRow *reflect.Value) map[string]interface{} {
 	res := make(map[string]interface{}, len(t.Fields))
 	var allSkipped bool = oldRow != nil
@@ -85,6 +133,9 @@ func (t *Table) marshalToJson(newRow reflect.Value, oldRow *reflect.Value) map[s
 		} else {
 			vSet = vF.Interface()
 		}
+		if vSet != nil && f.IsValuer {
+			vSet = jsonValuer(vF)
+		}
 		if vSet != nil {
 			if f.DataType == DateTime {
 				t, ok := vSet.(time.Time)
@@ -132,7 +183,7 @@ func (t *Table) marshalToJson(newRow reflect.Value, oldRow *reflect.Value) map[s
 		case reflect.Slice:
 			var chOV reflect.Value
 			jsonChArray := make([]map[string]interface{}, 0, 10)
-			oldRows := make(map[int64]reflect.Value, 10)
+			oldRows := make(map[rowKey]reflect.Value, 10)
 			if oldRow != nil {
 				chOV = (*oldRow).FieldByIndex(ch.ClassIdx)
 				if !chOV.IsNil() {
@@ -140,9 +191,8 @@ func (t *Table) marshalToJson(newRow reflect.Value, oldRow *reflect.Value) map[s
 					for i := 0; i < ol; i++ {
 						vv := chOV.Index(i)
 						vv = vv.Elem()
-						vID := vv.FieldByIndex(ch.PrimaryKey.ClassIdx)
-						id, ee := parseInt(vID.Interface())
-						if ee != nil {
+						id, ee := ch.getKey(vv)
+						if ee == nil {
 							oldRows[id] = vv
 						}
 					}
@@ -153,8 +203,7 @@ func (t *Table) marshalToJson(newRow reflect.Value, oldRow *reflect.Value) map[s
 				for i := 0; i < l; i++ {
 					vv := chV.Index(i)
 					vv = vv.Elem()
-					vID := vv.FieldByIndex(ch.PrimaryKey.ClassIdx)
-					id, ee := parseInt(vID.Interface())
+					id, ee := ch.getKey(vv)
 					if ee == nil {
 						chOV, ok := oldRows[id]
 						if ok {
@@ -179,7 +228,7 @@ func (t *Table) marshalToJson(newRow reflect.Value, oldRow *reflect.Value) map[s
 			if len(oldRows) > 0 {
 				allSkipped = false
 				for id, _ := range oldRows {
-					res[fmt.Sprintf("%s[%d]", ch.TableName, id)] = nil
+					res[fmt.Sprintf("%s[%s]", ch.TableName, id)] = nil
 				}
 			}
 		}
@@ -192,15 +241,12 @@ func (t *Table) marshalToJson(newRow reflect.Value, oldRow *reflect.Value) map[s
 	}
 }
 
-func parseName(fullName string) (name string, id int64, e error) {
+// parseName splits scope[key] name, the key is parsed by the scope table
+func parseName(fullName string) (name string, id string, e error) {
 	if strings.HasSuffix(fullName, "]") {
 		idx := strings.Index(fullName, "[")
 		if idx > 0 {
-			ids := fullName[idx+1 : len(fullName)-1]
-			id, e = strconv.ParseInt(ids, 10, 64)
-			if e != nil {
-				return
-			}
+			id = fullName[idx+1 : len(fullName)-1]
 			name = fullName[:idx]
 			if idx == 0 {
 				e = fmt.Errorf("Invalid name: %s", fullName)
@@ -212,22 +258,20 @@ func parseName(fullName string) (name string, id int64, e error) {
 	return
 }
 
-func (t *Table) getId(row reflect.Value) int64 {
-	vId := row.FieldByIndex(t.PrimaryKey.ClassIdx)
-	k := vId.Type().Kind()
-	if k == reflect.Ptr {
-		vId = vId.Elem()
-	}
-	switch k {
-	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
-		return vId.Int()
-	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return int64(vId.Uint())
+func (t *Table) getId(row reflect.Value) rowKey {
+	key, _ := t.getKey(row)
+	return key
+}
+
+// keyOfName parses the key of scope[key] name, empty name is zero key
+func (t *Table) keyOfName(id string) (rowKey, error) {
+	if len(id) == 0 {
+		return t.zeroKey(), nil
 	}
-	return 0
+	return t.parseKey(id)
 }
 
-func (t *Table) idxWithId(id int64, slice reflect.Value, lastIdx int) int {
+func (t *Table) idxWithId(id rowKey, slice reflect.Value, lastIdx int) int {
 	for i := 0; i < lastIdx; i++ {
 		vR := slice.Index(i)
 		if vR.IsValid() {
@@ -246,9 +290,24 @@ func (t *Table) applyJson(row reflect.Value, js map[string]interface{}) error {
 	var e error
 	var name string
 	var idx int
-	var rowId int64
+	var rowId rowKey
+	var keyName string
 
 	for key, value := range js {
+		if f := t.FieldByName(key); f != nil && f.isJsonDocument() {
+			var doc interface{}
+			if value != nil {
+				doc, e = json.Marshal(value)
+				if e != nil {
+					return e
+				}
+			}
+			e = scanJsonDocument(row.FieldByIndex(f.ClassIdx).Addr().Interface(), doc)
+			if e != nil {
+				return fmt.Errorf("Field %s: %v", key, e)
+			}
+			continue
+		}
 		switch jn := value.(type) {
 		case []interface{}:
 			ch := t.ChildByName(key)
@@ -267,16 +326,12 @@ func (t *Table) applyJson(row reflect.Value, js map[string]interface{}) error {
 			for _, jsn1 := range jn {
 				jsn, ok := jsn1.(map[string]interface{})
 				if ok {
-					rowId = 0
-					iv, ok := jsn[ch.PrimaryKey.FieldName]
-					if ok {
-						rowId, e = parseInt(iv)
-						if e != nil {
-							return e
-						}
+					rowId, e = ch.keyOfJson(jsn)
+					if e != nil {
+						return e
 					}
 					idx = -1
-					if rowId != 0 {
+					if !rowId.isZero() {
 						idx = ch.idxWithId(rowId, chV, lastIdx)
 					}
 					if idx >= 0 {
@@ -295,7 +350,7 @@ func (t *Table) applyJson(row reflect.Value, js map[string]interface{}) error {
 				}
 			}
 		case map[string]interface{}:
-			name, rowId, e = parseName(key)
+			name, keyName, e = parseName(key)
 			if e != nil {
 				return e
 			}
@@ -303,6 +358,10 @@ func (t *Table) applyJson(row reflect.Value, js map[string]interface{}) error {
 			if ch == nil {
 				return fmt.Errorf("There is no scope \"%s\"", name)
 			}
+			rowId, e = ch.keyOfName(keyName)
+			if e != nil {
+				return e
+			}
 			chV := row.FieldByIndex(ch.ClassIdx)
 			if chV.IsNil() {
 				chVV := reflect.New(ch.RowClass)
@@ -326,21 +385,18 @@ func (t *Table) applyJson(row reflect.Value, js map[string]interface{}) error {
 					}
 				case reflect.Slice:
 					idx = -1
-					if rowId == 0 {
-						iv, ok := jn[ch.PrimaryKey.FieldName]
-						if ok {
-							rowId, e = parseInt(iv)
-							if e != nil {
-								return e
-							}
+					if rowId.isZero() {
+						rowId, e = ch.keyOfJson(jn)
+						if e != nil {
+							return e
 						}
 					}
-					if rowId != 0 {
+					if !rowId.isZero() {
 						idx = ch.idxWithId(rowId, chV, chV.Len())
 					}
 					if idx >= 0 {
 						chVV := chV.Index(idx)
-						e = ch.applyJson(chVV, jn)
+						e = ch.applyJson(chVV.Elem(), jn)
 					} else {
 						chVV := reflect.New(ch.RowClass)
 						chV.Set(reflect.Append(chV, chVV))
@@ -353,17 +409,21 @@ func (t *Table) applyJson(row reflect.Value, js map[string]interface{}) error {
 			}
 
 		case nil:
-			name, rowId, e = parseName(key)
+			name, keyName, e = parseName(key)
 			if e != nil {
 				return e
 			}
 			ch := t.ChildByName(name)
 			if ch != nil {
+				rowId, e = ch.keyOfName(keyName)
+				if e != nil {
+					return e
+				}
 				chV := row.FieldByIndex(ch.ClassIdx)
 				if !chV.IsNil() {
 					switch ch.ChildClass.Kind() {
 					case reflect.Ptr:
-						if idx != 0 {
+						if !rowId.isZero() {
 							rId := ch.getId(chV.Elem())
 							if rId == rowId {
 								chV.Set(reflect.Zero(ch.ChildClass))
@@ -372,7 +432,7 @@ func (t *Table) applyJson(row reflect.Value, js map[string]interface{}) error {
 							chV.Set(reflect.Zero(ch.ChildClass))
 						}
 					case reflect.Slice:
-						if rowId != 0 {
+						if !rowId.isZero() {
 							idx = ch.idxWithId(rowId, chV, chV.Len())
 							if idx >= 0 {
 								l := chV.Len()
@@ -436,7 +496,10 @@ func (conn *GorbManager) EntityJsonApply(entity interface{}, js []byte) error {
 
 	var e error
 	var j map[string]interface{}
-	e = json.Unmarshal(js, &j)
+	// numbers are kept as text for Decimal fields
+	decoder := json.NewDecoder(bytes.NewReader(js))
+	decoder.UseNumber()
+	e = decoder.Decode(&j)
 	if e != nil {
 		return e
 	}
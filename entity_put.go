@@ -22,15 +22,15 @@ const (
 
 type (
 	entityInfo interface {
-		hasRow(tableNo int32, rowId int64) bool
-		rowUpdated(tableNo int32, rowId int64)
-		rowInserted(tableNo int32, rowId int64)
-		rowDeleted(tableNo int32, rowId int64)
-		rowSkipped(tableNo int32, rowId int64)
+		hasRow(tableNo int32, rowId rowKey) bool
+		rowUpdated(tableNo int32, rowId rowKey)
+		rowInserted(tableNo int32, rowId rowKey)
+		rowDeleted(tableNo int32, rowId rowKey)
+		rowSkipped(tableNo int32, rowId rowKey)
 	}
 
 	entityData struct {
-		pk    int64
+		pk    rowKey
 		token uint32
 
 		updated  int
@@ -43,19 +43,19 @@ type (
 	}
 	rowData struct {
 		tableNo int32
-		pk      int64
+		pk      rowKey
 		status  childRowStatus
 	}
 )
 
-func (data *entityData) findRow(tableNo int32, rowId int64) (index int, exact bool) {
+func (data *entityData) findRow(tableNo int32, rowId rowKey) (index int, exact bool) {
 	exact = false
 	index = sort.Search(data.children.Len(), func(i int) bool {
 		if data.children[i].tableNo > tableNo {
 			return true
 		}
 		if data.children[i].tableNo == tableNo {
-			return data.children[i].pk >= rowId
+			return !data.children[i].pk.less(rowId)
 		}
 		return false
 	})
@@ -69,12 +69,12 @@ func (data *entityData) findRow(tableNo int32, rowId int64) (index int, exact bo
 	return
 }
 
-func (data *entityData) hasRow(tableNo int32, rowId int64) bool {
+func (data *entityData) hasRow(tableNo int32, rowId rowKey) bool {
 	_, xct := data.findRow(tableNo, rowId)
 	return xct
 }
 
-func (data *entityData) rowUpdated(tableNo int32, rowId int64) {
+func (data *entityData) rowUpdated(tableNo int32, rowId rowKey) {
 	idx, xct := data.findRow(tableNo, rowId)
 	if xct {
 		data.children[idx].status = RowUpdated
@@ -84,7 +84,7 @@ func (data *entityData) rowUpdated(tableNo int32, rowId int64) {
 	}
 }
 
-func (data *entityData) rowInserted(tableNo int32, rowId int64) {
+func (data *entityData) rowInserted(tableNo int32, rowId rowKey) {
 	if tableNo == 0 {
 		data.pk = rowId
 	}
@@ -96,7 +96,7 @@ func (data *entityData) rowInserted(tableNo int32, rowId int64) {
 		data.missed++
 	}
 }
-func (data *entityData) rowDeleted(tableNo int32, rowId int64) {
+func (data *entityData) rowDeleted(tableNo int32, rowId rowKey) {
 	idx, xct := data.findRow(tableNo, rowId)
 	if xct {
 		data.children[idx].status = RowDeleted
@@ -105,7 +105,7 @@ func (data *entityData) rowDeleted(tableNo int32, rowId int64) {
 		data.missed++
 	}
 }
-func (data *entityData) rowSkipped(tableNo int32, rowId int64) {
+func (data *entityData) rowSkipped(tableNo int32, rowId rowKey) {
 	idx, xct := data.findRow(tableNo, rowId)
 	if xct {
 		data.children[idx].status = RowNotModified
@@ -123,7 +123,7 @@ func (s childRows) Less(i, j int) bool {
 		return true
 	}
 	if s[i].tableNo == s[j].tableNo {
-		return s[i].pk < s[j].pk
+		return s[i].pk.less(s[j].pk)
 	}
 	return false
 }
@@ -131,17 +131,17 @@ func (s childRows) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 
-func (ch *ChildTable) populateData(data *entityData, pk int64) error {
+func (ch *ChildTable) populateData(data *entityData, pk rowKey) error {
 	var e error = nil
 	var rows *sql.Rows
 
-	rows, e = ch.stmts.stmtInfo.Query(pk)
+	rows, e = ch.stmts.stmtInfo.Query(pk.sqlValue())
 	if e == nil {
 		var rd rowData
 		rd.tableNo = ch.tableNo
 		defer rows.Close()
 		for rows.Next() {
-			e = rows.Scan(&(rd.pk))
+			rd.pk, e = ch.scanKey(rows)
 			if e != nil {
 				break
 			}
@@ -151,9 +151,10 @@ func (ch *ChildTable) populateData(data *entityData, pk int64) error {
 
 	return e
 }
-func (ent *Entity) populateData(data *entityData, pk int64) error {
+func (ent *Entity) populateData(data *entityData, pk rowKey) error {
 	var e error = nil
-	e = ent.stmts.stmtInfo.QueryRow(pk).Scan(&((*data).pk), &((*data).token))
+	data.pk = rowKey{isString: pk.isString}
+	e = ent.stmts.stmtInfo.QueryRow(pk.sqlValue()).Scan(keyScanner{key: &data.pk}, &((*data).token))
 	if e != nil {
 		return e
 	}
@@ -170,32 +171,68 @@ func (t *Table) storeRow(txn *sql.Tx, row reflect.Value, logger entityInfo) erro
 	var res sql.Result
 	var stmt *sql.Stmt
 	var e error
-	var pk int64
 
 	pkValue := row.FieldByIndex(t.PrimaryKey.ClassIdx)
-	switch pkValue.Kind() {
-	case reflect.Int, reflect.Int32, reflect.Int64:
-		pk = pkValue.Int()
-	case reflect.Uint, reflect.Uint32, reflect.Uint64:
-		pk = int64(pkValue.Uint())
-	default:
-		return fmt.Errorf("Unsupported Primary Key type")
+	pk, e := t.getKey(row)
+	if e != nil {
+		return e
 	}
 
-	var isUpdate bool = pk != 0
+	var isUpdate bool = !pk.isZero()
 	if !t.IsPkSerial {
 		isUpdate = logger.hasRow(t.tableNo, pk)
 	}
+	if !isUpdate && !t.IsPkSerial && pk.isZero() {
+		if t.KeyGenerator == nil {
+			return fmt.Errorf("Primary key of %s is not set", t.TableName)
+		}
+		pk.str, e = t.KeyGenerator.NewKey()
+		if e != nil {
+			return e
+		}
+		e = setKey(pkValue, pk)
+		if e != nil {
+			return e
+		}
+	}
 
 	var flds []interface{} = make([]interface{}, 0, len(t.Fields))
 	for _, f := range t.Fields {
-		if f != t.PrimaryKey {
+		if !t.isKeyField(f) {
 			fv := row.FieldByIndex(f.ClassIdx)
 			if fv.Kind() == reflect.Ptr {
 				if !fv.IsNil() {
 					fv = fv.Elem()
 				}
 			}
+			if f.isJsonDocument() {
+				dv, e := marshalJsonDocument(row.FieldByIndex(f.ClassIdx), f.IsNullable)
+				if e != nil {
+					return fmt.Errorf("Field %s: %v", f.FieldName, e)
+				}
+				flds = append(flds, dv)
+				continue
+			}
+			if d, ok := fv.Interface().(Fixed); ok && f.DataType == Decimal {
+				// bound at the column scale, databases would round extra digits
+				d, e = d.fitColumn(f.Precision, f.Scale)
+				if e != nil {
+					return fmt.Errorf("Field %s: %v", f.FieldName, e)
+				}
+				flds = append(flds, d.String())
+				continue
+			}
+			if f.IsValuer {
+				var dv interface{}
+				if valuer, ok := valuerOf(fv); ok {
+					dv, e = valuer.Value()
+					if e != nil {
+						return fmt.Errorf("Field %s: %v", f.FieldName, e)
+					}
+				}
+				flds = append(flds, dv)
+				continue
+			}
 			fvi := fv.Interface()
 			switch p := fvi.(type) {
 			case time.Time:
@@ -208,32 +245,36 @@ func (t *Table) storeRow(txn *sql.Tx, row reflect.Value, logger entityInfo) erro
 	}
 
 	if isUpdate {
-		flds = append(flds, pk)
+		flds = append(flds, pk.sqlValues()...)
 		stmt = t.stmts.stmtUpdate
 		if txn != nil {
 			stmt = txn.Stmt(stmt)
 		}
 	} else {
 		if !t.IsPkSerial {
-			flds = append([]interface{}{pk}, flds...)
+			flds = append(pk.sqlValues(), flds...)
 		}
 		stmt = t.stmts.stmtInsert
 		if txn != nil {
 			stmt = txn.Stmt(stmt)
 		}
 	}
-	res, e = stmt.Exec(flds...)
-	if e != nil {
-		return e
-	}
-
 	var rowsAffected int64
-	rowsAffected, e = res.RowsAffected()
+	var isReturning bool = !isUpdate && t.IsPkSerial && t.stmts.isInsertReturning
+	if isReturning {
+		e = stmt.QueryRow(flds...).Scan(&pk.id)
+		rowsAffected = 1
+	} else {
+		res, e = stmt.Exec(flds...)
+		if e == nil {
+			rowsAffected, e = res.RowsAffected()
+		}
+	}
 	if e != nil {
 		return e
 	}
 	if rowsAffected > 1 {
-		fmt.Errorf("Insert/Update: expected 0 or 1 row to be affected: %d", rowsAffected)
+		return fmt.Errorf("Insert/Update: expected 0 or 1 row to be affected: %d", rowsAffected)
 	}
 
 	if isUpdate {
@@ -243,14 +284,13 @@ func (t *Table) storeRow(txn *sql.Tx, row reflect.Value, logger entityInfo) erro
 			logger.rowUpdated(t.tableNo, pk)
 		}
 	} else {
-		pk, e = res.LastInsertId()
+		if t.IsPkSerial && !isReturning {
+			pk.id, e = res.LastInsertId()
+		}
+		if e == nil && t.IsPkSerial {
+			e = setKey(pkValue, pk)
+		}
 		if e == nil {
-			switch pkValue.Kind() {
-			case reflect.Int, reflect.Int32, reflect.Int64:
-				pkValue.SetInt(pk)
-			case reflect.Uint, reflect.Uint32, reflect.Uint64:
-				pkValue.SetUint(uint64(pk))
-			}
 			logger.rowInserted(t.tableNo, pk)
 		}
 	}
@@ -312,23 +352,10 @@ func (t *Table) storeRow(txn *sql.Tx, row reflect.Value, logger entityInfo) erro
 	return e
 }
 
-func (c *ChildTable) storeChildRow(txn *sql.Tx, row reflect.Value, parentId int64, logger entityInfo) error {
-	fkValue := row.FieldByIndex(c.ParentKey.ClassIdx)
-	fkKind := fkValue.Type().Kind()
-	if fkKind == reflect.Ptr {
-		if fkValue.IsNil() {
-			v := reflect.New(fkValue.Type().Elem())
-			fkValue.Set(v)
-			fkValue = v
-		}
-	}
-	switch fkKind {
-	case reflect.Int, reflect.Int32, reflect.Int64:
-		fkValue.SetInt(parentId)
-	case reflect.Uint, reflect.Uint32, reflect.Uint64:
-		fkValue.SetUint(uint64(parentId))
-	default:
-		return fmt.Errorf("Unsupported Primary Key type")
+func (c *ChildTable) storeChildRow(txn *sql.Tx, row reflect.Value, parentId rowKey, logger entityInfo) error {
+	e := setKey(row.FieldByIndex(c.ParentKey.ClassIdx), parentId)
+	if e != nil {
+		return e
 	}
 
 	return c.storeRow(txn, row, logger)
@@ -362,25 +389,29 @@ func (conn *GorbManager) EntityPut(entity interface{}) error {
 		}
 	}
 
+	e = conn.EntityValidate(entity)
+	if e != nil {
+		return e
+	}
+
 	var eData entityData
 
 	eValue := reflect.ValueOf(entity)
 	if isPtr {
 		eValue = eValue.Elem()
 	}
-	pkValue := eValue.FieldByIndex(ent.PrimaryKey.ClassIdx)
-	switch pkValue.Kind() {
-	case reflect.Int, reflect.Int32, reflect.Int64:
-		eData.pk = pkValue.Int()
-	case reflect.Uint, reflect.Uint32, reflect.Uint64:
-		eData.pk = int64(pkValue.Uint())
-	default:
-		return fmt.Errorf("Unsupported Primary Key type")
+	eData.pk, e = ent.getKey(eValue)
+	if e != nil {
+		return e
 	}
-	if eData.pk != 0 {
+	if !eData.pk.isZero() {
 		eData.children = make([]rowData, 0, 16)
 		e := ent.populateData(&eData, eData.pk)
-		if e != nil {
+		if e == sql.ErrNoRows && !ent.IsPkSerial {
+			// new entity with the key set by the caller
+			eData.children = eData.children[:0]
+			e = nil
+		} else if e != nil {
 			return e
 		}
 		if len(eData.children) > 0 {
@@ -396,7 +427,7 @@ func (conn *GorbManager) EntityPut(entity interface{}) error {
 	}
 
 	var txn *sql.Tx = nil
-	if len(ent.Children) > 0 {
+	if len(ent.Children) > 0 || len(ent.Relations) > 0 {
 		txn, e = conn.db.Begin()
 		if e != nil {
 			return e
@@ -405,6 +436,9 @@ func (conn *GorbManager) EntityPut(entity interface{}) error {
 
 	var t *Table = &((*ent).Table)
 	e = t.storeRow(txn, eValue, &eData)
+	if e == nil && len(ent.Relations) > 0 {
+		e = ent.storeRelations(txn, eValue, eData.pk)
+	}
 
 	if e == nil {
 		if len(eData.children) > eData.updated+eData.skipped {
@@ -425,7 +459,7 @@ func (conn *GorbManager) EntityPut(entity interface{}) error {
 							}
 							lastTableNo = child.tableNo
 						}
-						res, e = stmt.Exec(rd.pk)
+						res, e = stmt.Exec(rd.pk.sqlValues()...)
 						if e != nil {
 							break
 						}
@@ -442,7 +476,7 @@ func (conn *GorbManager) EntityPut(entity interface{}) error {
 		}
 	}
 
-	if e == nil && txn != nil {
+	if txn != nil {
 		if e == nil {
 			e = txn.Commit()
 		} else {
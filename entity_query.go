@@ -128,12 +128,13 @@ func (wc *WhereClause) Or(criteria *WhereCriteria) WhereClause {
 }
 
 func (wc *WhereClause) Dump() {
-	where, params := wc.createWhereClause()
+	where, params := wc.createWhereClause(MySqlDialect{}, 1)
 	fmt.Println(where)
 	fmt.Printf("%q\n", params)
 }
 
-func (wc *WhereClause) createWhereClause() (string, []interface{}) {
+// createWhereClause renders the clause with placeholders numbered from firstParam
+func (wc *WhereClause) createWhereClause(d Dialect, firstParam int) (string, []interface{}) {
 	var buffer bytes.Buffer
 	var params []interface{} = make([]interface{}, 0, 8)
 
@@ -150,7 +151,7 @@ func (wc *WhereClause) createWhereClause() (string, []interface{}) {
 				buffer.WriteString(" AND ")
 			}
 			buffer.WriteString("(")
-			buffer.WriteString(c.field.SqlName)
+			buffer.WriteString(d.QuoteIdentifier(c.field.SqlName))
 			if c.value == nil {
 				buffer.WriteString(" IS")
 				if c.isExclude {
@@ -186,7 +187,8 @@ func (wc *WhereClause) createWhereClause() (string, []interface{}) {
 					buffer.WriteString(" ### ")
 				}
 
-				buffer.WriteString(" ?")
+				buffer.WriteString(" ")
+				buffer.WriteString(d.Placeholder(firstParam + len(params)))
 				switch p := c.value.(type) {
 				case time.Time:
 					c.value = p.UTC()
@@ -203,7 +205,25 @@ func (wc *WhereClause) createWhereClause() (string, []interface{}) {
 	return buffer.String(), params
 }
 
+// EntityQueryIds returns integer primary keys of the entities matching the request
 func (mgr *GorbManager) EntityQueryIds(request *RequestQuery) ([]int64, error) {
+	if request.ent.hasStringKey() {
+		return nil, fmt.Errorf("Entity %s has String primary key, use EntityQueryKeys", request.ent.TableName)
+	}
+	keys, e := mgr.EntityQueryKeys(request)
+	if e != nil {
+		return nil, e
+	}
+	var ids []int64 = make([]int64, len(keys))
+	for i, key := range keys {
+		ids[i] = key.(int64)
+	}
+	return ids, nil
+}
+
+// EntityQueryKeys returns primary keys of the entities matching the request,
+// int64 values for integer keys and string values for String keys
+func (mgr *GorbManager) EntityQueryKeys(request *RequestQuery) ([]interface{}, error) {
 	if mgr.db == nil {
 		return nil, fmt.Errorf("Database connection is not set")
 	}
@@ -214,20 +234,16 @@ func (mgr *GorbManager) EntityQueryIds(request *RequestQuery) ([]int64, error) {
 	var whereClause string
 	var whereParams []interface{}
 
-	query.WriteString(fmt.Sprintf("SELECT %s FROM %s", request.ent.PrimaryKey.SqlName, request.ent.TableName))
+	var d Dialect = mgr.dialect()
+	query.WriteString(fmt.Sprintf("SELECT %s FROM %s", d.QuoteIdentifier(request.ent.PrimaryKey.SqlName), d.QuoteIdentifier(request.ent.TableName)))
 
 	if len(request.WhereClause) > 0 {
-		whereClause, whereParams = request.WhereClause.createWhereClause()
+		whereClause, whereParams = request.WhereClause.createWhereClause(d, 1)
 		query.WriteString(" WHERE ")
 		query.WriteString(whereClause)
 	}
 
-	if request.Limit > 0 {
-		query.WriteString(fmt.Sprintf(" LIMIT %d", request.Limit))
-		if request.Offset > 0 {
-			query.WriteString(fmt.Sprintf(" OFFSET %d", request.Offset))
-		}
-	}
+	query.WriteString(d.Paginate(request.Limit, request.Offset))
 
 	var rows *sql.Rows
 	rows, e = mgr.db.Query(query.String(), whereParams...)
@@ -235,14 +251,14 @@ func (mgr *GorbManager) EntityQueryIds(request *RequestQuery) ([]int64, error) {
 		return nil, e
 	}
 
-	var ids []int64 = make([]int64, 0, 64)
+	var ids []interface{} = make([]interface{}, 0, 64)
 	for rows.Next() {
-		var id int64
-		e = rows.Scan(&id)
+		var id rowKey = rowKey{isString: request.ent.hasStringKey()}
+		e = rows.Scan(keyScanner{key: &id})
 		if e != nil {
 			break
 		}
-		ids = append(ids, id)
+		ids = append(ids, id.sqlValue())
 	}
 
 	rows.Close()
@@ -264,20 +280,16 @@ func (mgr *GorbManager) EntityQuery(request *RequestQuery) ([]interface{}, error
 	var whereClause string
 	var whereParams []interface{}
 
+	var d Dialect = mgr.dialect()
 	query.WriteString(request.ent.selectFields)
 
 	if len(request.WhereClause) > 0 {
-		whereClause, whereParams = request.WhereClause.createWhereClause()
+		whereClause, whereParams = request.WhereClause.createWhereClause(d, 1)
 		query.WriteString(" WHERE ")
 		query.WriteString(whereClause)
 	}
 
-	if request.Limit > 0 {
-		query.WriteString(fmt.Sprintf(" LIMIT %d", request.Limit))
-		if request.Offset > 0 {
-			query.WriteString(fmt.Sprintf(" OFFSET %d", request.Offset))
-		}
-	}
+	query.WriteString(d.Paginate(request.Limit, request.Offset))
 
 	var queryStr string = query.String()
 	var rows *sql.Rows
@@ -309,6 +321,7 @@ func (mgr *GorbManager) EntityQuery(request *RequestQuery) ([]interface{}, error
 			if ok {
 				fV := v.FieldByIndex(f.ClassIdx)
 				gs.ptr = fV.Addr().Interface()
+				gs.isJson = f.isJsonDocument()
 			} else {
 				e = fmt.Errorf("Should not happen")
 				break
@@ -325,6 +338,9 @@ func (mgr *GorbManager) EntityQuery(request *RequestQuery) ([]interface{}, error
 
 		if !request.IsHeaderOnly {
 			e = request.ent.populateChildren(v)
+			if e == nil {
+				e = request.ent.populateReferences(v)
+			}
 		}
 
 		if e != nil {
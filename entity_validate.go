@@ -0,0 +1,290 @@
+package gorb
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type (
+	// ValidationRules are declared with min, max, len, pattern and oneof properties.
+	// min and max limit numbers or the length of strings, len is the exact length of strings.
+	// Patterns and values containing commas are quoted: pattern='^[a-z]{2,3}$', oneof='new open closed'
+	ValidationRules struct {
+		Min       *Fixed
+		Max       *Fixed
+		Length    int
+		HasLength bool
+		Pattern   *regexp.Regexp
+		OneOf     []string
+	}
+
+	// FieldViolation is a failed rule of a field, Path is the field path from the entity: Lines[1].Sku
+	FieldViolation struct {
+		Path    string
+		Rule    string
+		Message string
+	}
+
+	// ValidationError lists all violations found by EntityValidate
+	ValidationError struct {
+		Violations []*FieldViolation
+	}
+)
+
+// splitTag splits tag properties at commas that are not enclosed in single quotes
+func splitTag(tag string) []string {
+	var props []string = make([]string, 0, 4)
+	var isQuoted bool
+	var start int
+	for i, r := range tag {
+		switch r {
+		case '\'':
+			isQuoted = !isQuoted
+		case ',':
+			if !isQuoted {
+				props = append(props, tag[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(props, tag[start:])
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+func isNumericType(dt DataType) bool {
+	return isIntegerType(dt) || dt == Float || dt == Decimal
+}
+
+func (f *Field) parseRule(key, value string) error {
+	if f.Rules == nil {
+		f.Rules = new(ValidationRules)
+	}
+	value = unquote(value)
+	switch key {
+	case TagMin, TagMax:
+		if !isNumericType(f.DataType) && f.DataType != String {
+			return fmt.Errorf("Field %s: %s is supported for numbers and strings", f.SqlName, key)
+		}
+		bound, e := ParseFixed(value)
+		if e != nil {
+			return fmt.Errorf("Field %s: invalid %s %s", f.SqlName, key, value)
+		}
+		if key == TagMin {
+			f.Rules.Min = &bound
+		} else {
+			f.Rules.Max = &bound
+		}
+	case TagLen:
+		length, e := strconv.Atoi(value)
+		if e != nil || length < 0 || f.DataType != String {
+			return fmt.Errorf("Field %s: invalid len %s", f.SqlName, value)
+		}
+		f.Rules.Length, f.Rules.HasLength = length, true
+	case TagPattern:
+		if f.DataType != String {
+			return fmt.Errorf("Field %s: pattern is supported for strings", f.SqlName)
+		}
+		pattern, e := regexp.Compile(value)
+		if e != nil {
+			return fmt.Errorf("Field %s: %v", f.SqlName, e)
+		}
+		f.Rules.Pattern = pattern
+	case TagOneOf:
+		if !isIntegerType(f.DataType) && f.DataType != String {
+			return fmt.Errorf("Field %s: oneof is supported for integers and strings", f.SqlName)
+		}
+		f.Rules.OneOf = strings.Fields(value)
+		if len(f.Rules.OneOf) == 0 {
+			return fmt.Errorf("Field %s: oneof expects values", f.SqlName)
+		}
+	}
+	return nil
+}
+
+func (e *ValidationError) Error() string {
+	var buffer bytes.Buffer
+	buffer.WriteString("Validation failed:")
+	for _, v := range e.Violations {
+		buffer.WriteString(fmt.Sprintf("\n\t%s: %s", v.Path, v.Message))
+	}
+	return buffer.String()
+}
+
+func (e *ValidationError) add(path, rule, message string) {
+	e.Violations = append(e.Violations, &FieldViolation{Path: path, Rule: rule, Message: message})
+}
+
+// compareNumber returns -1, 0 or +1 if the numeric value is less than, equal or greater than bound
+func compareNumber(v reflect.Value, bound Fixed) int {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewFixed(v.Int(), 0).Cmp(bound)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return 1
+		}
+		return NewFixed(int64(v.Uint()), 0).Cmp(bound)
+	case reflect.Float32, reflect.Float64:
+		b, _ := strconv.ParseFloat(bound.String(), 64)
+		switch f := v.Float(); {
+		case f < b:
+			return -1
+		case f > b:
+			return 1
+		}
+		return 0
+	}
+	if d, ok := v.Interface().(Fixed); ok {
+		return d.Cmp(bound)
+	}
+	return 0
+}
+
+// isMissingValue reports nil pointers, empty strings, slices and maps.
+// Zero numbers, false and zero times are values.
+func isMissingValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.String, reflect.Map, reflect.Slice:
+		return v.Len() == 0
+	}
+	return false
+}
+
+// validateField checks req, :length and validation rules of the field value
+func (f *Field) validateField(v reflect.Value, path string, ve *ValidationError) {
+	if f.IsRequired && isMissingValue(v) {
+		ve.add(path, TagReq, "is required")
+		return
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	var rules *ValidationRules = f.Rules
+	if rules == nil {
+		rules = new(ValidationRules)
+	}
+	if f.DataType == String && v.Kind() == reflect.String {
+		s := v.String()
+		length := utf8.RuneCountInString(s)
+		if f.Precision > 0 && length > int(f.Precision) {
+			ve.add(path, "length", fmt.Sprintf("length %d exceeds %d", length, f.Precision))
+		}
+		if rules.HasLength && length != rules.Length {
+			ve.add(path, TagLen, fmt.Sprintf("length %d is not %d", length, rules.Length))
+		}
+		if rules.Min != nil && NewFixed(int64(length), 0).Cmp(*rules.Min) < 0 {
+			ve.add(path, TagMin, fmt.Sprintf("length %d is less than %s", length, rules.Min))
+		}
+		if rules.Max != nil && NewFixed(int64(length), 0).Cmp(*rules.Max) > 0 {
+			ve.add(path, TagMax, fmt.Sprintf("length %d is greater than %s", length, rules.Max))
+		}
+		if rules.Pattern != nil && !rules.Pattern.MatchString(s) {
+			ve.add(path, TagPattern, fmt.Sprintf("does not match %s", rules.Pattern))
+		}
+	} else if isNumericType(f.DataType) {
+		if rules.Min != nil && compareNumber(v, *rules.Min) < 0 {
+			ve.add(path, TagMin, fmt.Sprintf("%v is less than %s", v.Interface(), rules.Min))
+		}
+		if rules.Max != nil && compareNumber(v, *rules.Max) > 0 {
+			ve.add(path, TagMax, fmt.Sprintf("%v is greater than %s", v.Interface(), rules.Max))
+		}
+	}
+	if len(rules.OneOf) > 0 {
+		var s string = fmt.Sprint(v.Interface())
+		var isFound bool
+		for _, option := range rules.OneOf {
+			isFound = isFound || option == s
+		}
+		if !isFound {
+			ve.add(path, TagOneOf, fmt.Sprintf("%s is not one of %s", s, strings.Join(rules.OneOf, ", ")))
+		}
+	}
+}
+
+// validateRow checks fields of the row and its child rows, path prefixes field paths of child rows
+func (t *Table) validateRow(row reflect.Value, path string, parentKey *Field, ve *ValidationError) {
+	for _, f := range t.Fields {
+		if t.isKeyField(f) || f == parentKey {
+			// keys are assigned by EntityPut
+			continue
+		}
+		f.validateField(row.FieldByIndex(f.ClassIdx), path+t.fieldPathName(f), ve)
+	}
+
+	for _, child := range t.Children {
+		childStorage := row.FieldByIndex(child.ClassIdx)
+		if childStorage.IsNil() {
+			continue
+		}
+		name := path + t.indexPathName(child.ClassIdx)
+		switch child.ChildClass.Kind() {
+		case reflect.Ptr:
+			child.validateRow(childStorage.Elem(), name+".", child.ParentKey, ve)
+		case reflect.Slice:
+			for i := 0; i < childStorage.Len(); i++ {
+				childRow := childStorage.Index(i)
+				if childRow.Kind() == reflect.Ptr {
+					if childRow.IsNil() {
+						continue
+					}
+					childRow = childRow.Elem()
+				}
+				child.validateRow(childRow, fmt.Sprintf("%s[%d].", name, i), child.ParentKey, ve)
+			}
+		case reflect.Map:
+			for _, key := range childStorage.MapKeys() {
+				childRow := childStorage.MapIndex(key)
+				if childRow.Kind() == reflect.Ptr {
+					if childRow.IsNil() {
+						continue
+					}
+					childRow = childRow.Elem()
+				}
+				child.validateRow(childRow, fmt.Sprintf("%s[%v].", name, key.Interface()), child.ParentKey, ve)
+			}
+		}
+	}
+}
+
+// EntityValidate checks req, :length and validation rules of the entity and all its child rows.
+// It returns *ValidationError listing all violations. EntityPut validates entities before storing them.
+func (conn *GorbManager) EntityValidate(entity interface{}) error {
+	eType := reflect.TypeOf(entity)
+	var isPtr = eType.Kind() == reflect.Ptr
+	if isPtr {
+		eType = eType.Elem()
+	}
+	var ent *Entity = conn.LookupEntity(eType)
+	if ent == nil {
+		return fmt.Errorf("Unsupported entity %s", eType.Name())
+	}
+	eValue := reflect.ValueOf(entity)
+	if isPtr {
+		eValue = eValue.Elem()
+	}
+
+	var ve ValidationError
+	ent.validateRow(eValue, "", nil, &ve)
+	if len(ve.Violations) > 0 {
+		return &ve
+	}
+	return nil
+}
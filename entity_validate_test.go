@@ -0,0 +1,69 @@
+package gorb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type (
+	vdTicket struct {
+		Id       int64     `gorb:"id,pk"`
+		Code     string    `gorb:"code,:8,pattern='^[A-Z]{2,3}-[0-9]+$'"`
+		Title    string    `gorb:"title,:20,req,min=3"`
+		Status   string    `gorb:"status,oneof='new open closed'"`
+		Priority int32     `gorb:"priority,min=1,max=5"`
+		Level    int32     `gorb:"level,req"`
+		IsOpen   bool      `gorb:"is_open,req"`
+		Budget   Fixed     `gorb:"budget,:10.2,max=1000.50"`
+		Country  *string   `gorb:"country,len=2"`
+		Notes    []*vdNote `gorb:"vd_note"`
+	}
+	vdNote struct {
+		Id       int64  `gorb:"id,pk"`
+		TicketId int64  `gorb:"ticket_id,fk"`
+		Text     string `gorb:"text,req,max=10"`
+	}
+)
+
+func TestEntityValidate(t *testing.T) {
+	if props := splitTag(`code,:8,pattern='^[A-Z]{2,3}$',req`); len(props) != 4 || props[2] != `pattern='^[A-Z]{2,3}$'` {
+		t.Error(props)
+	}
+
+	var m GorbManager
+	if _, e := m.RegisterEntity(reflect.TypeOf(vdTicket{}), "vd_ticket"); e != nil {
+		t.Fatal(e)
+	}
+	// zero Level and false IsOpen are values of required fields
+	ticket := &vdTicket{Code: "AB-12", Title: "Printer", Status: "open", Priority: 3, Budget: NewFixed(100050, 2),
+		Notes: []*vdNote{{Text: "ok"}}}
+	if e := m.EntityValidate(ticket); e != nil {
+		t.Fatal(e)
+	}
+
+	country := "LVA"
+	ticket = &vdTicket{Code: "ab-123456", Status: "done", Priority: 7, Budget: NewFixed(100051, 2), Country: &country,
+		Notes: []*vdNote{{Text: "ok"}, {}, {Text: "much too long"}}}
+	e := m.EntityValidate(ticket)
+	ve, ok := e.(*ValidationError)
+	if !ok {
+		t.Fatal(e)
+	}
+	var found []string
+	for _, v := range ve.Violations {
+		found = append(found, v.Path+":"+v.Rule)
+	}
+	expected := "Code:length,Code:pattern,Title:req,Status:oneof,Priority:max,Budget:max,Country:len,Notes[1].Text:req,Notes[2].Text:max"
+	if strings.Join(found, ",") != expected {
+		t.Error(strings.Join(found, ","), "\n", e)
+	}
+
+	type vdBad struct {
+		Id    int64 `gorb:"id,pk"`
+		Count int32 `gorb:"count,pattern='[0-9]'"`
+	}
+	if _, e = m.RegisterEntity(reflect.TypeOf(vdBad{}), "vd_bad"); e == nil {
+		t.Error("pattern accepted for integer field")
+	}
+}
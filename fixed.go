@@ -0,0 +1,249 @@
+package gorb
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxDecimalPrecision is the number of digits an int64 unscaled value can hold
+	MaxDecimalPrecision uint16 = 18
+	// Decimal fields without :precision.scale property are declared as DECIMAL(18,2)
+	DefaultDecimalPrecision uint16 = 18
+	DefaultDecimalScale     uint16 = 2
+)
+
+// Fixed is an exact fixed point number: unscaled / 10^scale, the Go type of Decimal fields.
+// It is scanned, stored and converted to JSON as text, never through float64.
+type Fixed struct {
+	unscaled int64
+	scale    uint8
+}
+
+var pow10 [19]int64
+
+func init() {
+	pow10[0] = 1
+	for i := 1; i < len(pow10); i++ {
+		pow10[i] = pow10[i-1] * 10
+	}
+}
+
+// NewFixed returns unscaled / 10^scale
+func NewFixed(unscaled int64, scale uint8) Fixed {
+	return Fixed{unscaled: unscaled, scale: scale}
+}
+
+// ParseFixed parses decimal numbers like "-12.30" or "1.5e2"
+func ParseFixed(s string) (Fixed, error) {
+	var d Fixed
+	var str string = strings.TrimSpace(s)
+	var exp int64
+	if idx := strings.IndexAny(str, "eE"); idx >= 0 {
+		var e error
+		exp, e = strconv.ParseInt(str[idx+1:], 10, 32)
+		if e != nil {
+			return d, fmt.Errorf("Invalid decimal: %s", s)
+		}
+		str = str[:idx]
+	}
+	var isNeg bool
+	if len(str) > 0 && (str[0] == '-' || str[0] == '+') {
+		isNeg = str[0] == '-'
+		str = str[1:]
+	}
+	var digits string = str
+	var scale int64
+	if idx := strings.Index(str, "."); idx >= 0 {
+		digits = str[:idx] + str[idx+1:]
+		scale = int64(len(str) - idx - 1)
+	}
+	if len(digits) == 0 || strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+		return d, fmt.Errorf("Invalid decimal: %s", s)
+	}
+	digits = strings.TrimLeft(digits, "0")
+	scale -= exp
+	// reject integer parts that can not fit before padding them with zeros
+	if len(digits) > 0 && int64(len(digits))-scale > int64(MaxDecimalPrecision) {
+		return d, fmt.Errorf("Decimal overflow: %s", s)
+	}
+	if scale < 0 {
+		if len(digits) > 0 {
+			digits += strings.Repeat("0", int(-scale))
+		}
+		scale = 0
+	}
+	// drop fraction zeros that do not fit
+	for scale > int64(MaxDecimalPrecision) && strings.HasSuffix(digits, "0") {
+		digits = digits[:len(digits)-1]
+		scale--
+	}
+	if scale > int64(MaxDecimalPrecision) || len(digits) > int(MaxDecimalPrecision) {
+		return d, fmt.Errorf("Decimal overflow: %s", s)
+	}
+	if len(digits) > 0 {
+		u, e := strconv.ParseInt(digits, 10, 64)
+		if e != nil {
+			return d, fmt.Errorf("Decimal overflow: %s", s)
+		}
+		d.unscaled = u
+	}
+	if isNeg {
+		d.unscaled = -d.unscaled
+	}
+	d.scale = uint8(scale)
+	return d, nil
+}
+
+func (d Fixed) Unscaled() int64 {
+	return d.unscaled
+}
+
+func (d Fixed) Scale() uint8 {
+	return d.scale
+}
+
+func (d Fixed) IsZero() bool {
+	return d.unscaled == 0
+}
+
+func (d Fixed) String() string {
+	var abs uint64 = uint64(d.unscaled)
+	if d.unscaled < 0 {
+		abs = uint64(-d.unscaled)
+	}
+	var digits string = strconv.FormatUint(abs, 10)
+	if d.scale > 0 {
+		if len(digits) <= int(d.scale) {
+			digits = strings.Repeat("0", int(d.scale)-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-int(d.scale)] + "." + digits[len(digits)-int(d.scale):]
+	}
+	if d.unscaled < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Rescale changes the scale, it fails if digits would be lost or the value overflows
+func (d Fixed) Rescale(scale uint8) (Fixed, error) {
+	if scale > uint8(MaxDecimalPrecision) {
+		return d, fmt.Errorf("Decimal scale %d exceeds %d", scale, MaxDecimalPrecision)
+	}
+	if scale >= d.scale {
+		m := pow10[scale-d.scale]
+		r := d.unscaled * m
+		if r/m != d.unscaled {
+			return d, fmt.Errorf("Decimal overflow: %s", d)
+		}
+		return Fixed{unscaled: r, scale: scale}, nil
+	}
+	m := pow10[d.scale-scale]
+	if d.unscaled%m != 0 {
+		return d, fmt.Errorf("Decimal %s does not fit scale %d", d, scale)
+	}
+	return Fixed{unscaled: d.unscaled / m, scale: scale}, nil
+}
+
+// fitColumn rescales d to the scale of DECIMAL(precision,scale) column,
+// it fails if digits would be lost or the value exceeds the precision
+func (d Fixed) fitColumn(precision, scale uint16) (Fixed, error) {
+	r, e := d.Rescale(uint8(scale))
+	if e != nil {
+		return d, e
+	}
+	if int(precision) < len(pow10) && (r.unscaled >= pow10[precision] || r.unscaled <= -pow10[precision]) {
+		return d, fmt.Errorf("Decimal %s exceeds precision %d.%d", d, precision, scale)
+	}
+	return r, nil
+}
+
+// Normalize removes trailing fraction zeros
+func (d Fixed) Normalize() Fixed {
+	for d.scale > 0 && d.unscaled%10 == 0 {
+		d.unscaled /= 10
+		d.scale--
+	}
+	return d
+}
+
+// Cmp compares values regardless of scale: -1 if d < other, 0 if equal, +1 if d > other
+func (d Fixed) Cmp(other Fixed) int {
+	if d.scale == other.scale {
+		switch {
+		case d.unscaled < other.unscaled:
+			return -1
+		case d.unscaled > other.unscaled:
+			return 1
+		}
+		return 0
+	}
+	var a, b *big.Int = big.NewInt(d.unscaled), big.NewInt(other.unscaled)
+	if d.scale < other.scale {
+		a.Mul(a, big.NewInt(pow10[other.scale-d.scale]))
+	} else {
+		b.Mul(b, big.NewInt(pow10[d.scale-other.scale]))
+	}
+	return a.Cmp(b)
+}
+
+func (d Fixed) Equal(other Fixed) bool {
+	return d.Cmp(other) == 0
+}
+
+func (d Fixed) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON accepts JSON numbers and strings
+func (d *Fixed) UnmarshalJSON(data []byte) error {
+	var s string = string(data)
+	if s == "null" {
+		return nil
+	}
+	if len(s) > 1 && s[0] == '"' {
+		e := json.Unmarshal(data, &s)
+		if e != nil {
+			return e
+		}
+	}
+	dd, e := ParseFixed(s)
+	if e != nil {
+		return e
+	}
+	*d = dd
+	return nil
+}
+
+// Scan implements sql.Scanner. Floating point values are rejected.
+func (d *Fixed) Scan(value interface{}) error {
+	var e error
+	switch src := value.(type) {
+	case nil:
+		*d = Fixed{}
+	case []byte:
+		*d, e = ParseFixed(string(src))
+	case string:
+		*d, e = ParseFixed(src)
+	case json.Number:
+		*d, e = ParseFixed(string(src))
+	case int64:
+		*d = Fixed{unscaled: src}
+	case int32:
+		*d = Fixed{unscaled: int64(src)}
+	case int:
+		*d = Fixed{unscaled: int64(src)}
+	default:
+		e = fmt.Errorf("Cannot convert to Fixed: %v %T", src, src)
+	}
+	return e
+}
+
+// Value implements driver.Valuer, the value is passed as text
+func (d Fixed) Value() (driver.Value, error) {
+	return d.String(), nil
+}
@@ -0,0 +1,90 @@
+package gorb
+
+import (
+	"reflect"
+	"testing"
+)
+
+type fxInvoice struct {
+	Id        int64  `gorb:"id,pk"`
+	Total     Fixed  `gorb:"total,:12.2"`
+	Discount  *Fixed `gorb:"discount"`
+	Reference string `gorb:"reference,:20"`
+}
+
+func TestFixed(t *testing.T) {
+	for in, out := range map[string]string{"12.30": "12.30", "-0.05": "-0.05", "1.5e2": "150", "+7": "7", ".5": "0.5", "0e200000": "0"} {
+		d, e := ParseFixed(in)
+		if e != nil || d.String() != out {
+			t.Error(in, d, e)
+		}
+	}
+	for _, in := range []string{"", "1.2.3", "abc", "12345678901234567890", "1e200000", "1e-200000"} {
+		if _, e := ParseFixed(in); e == nil {
+			t.Error("accepted", in)
+		}
+	}
+	if !NewFixed(150, 2).Equal(NewFixed(15, 1)) || NewFixed(-1, 0).Cmp(NewFixed(1, 3)) != -1 {
+		t.Error("compare")
+	}
+	if _, e := NewFixed(155, 2).Rescale(1); e == nil {
+		t.Error("rescale lost digits")
+	}
+	if d, e := NewFixed(15, 1).fitColumn(12, 2); e != nil || d.String() != "1.50" {
+		t.Error(d, e)
+	}
+	if _, e := NewFixed(155, 2).fitColumn(12, 1); e == nil {
+		t.Error("fraction digits lost")
+	}
+	if _, e := NewFixed(-10000000000, 0).fitColumn(12, 2); e == nil {
+		t.Error("precision overflow accepted")
+	}
+
+	var d Fixed
+	if d.Scan(0.1) == nil {
+		t.Error("float64 scanned")
+	}
+	var gs gorbScanner = gorbScanner{ptr: &d}
+	if e := gs.Scan([]byte("99999999.99")); e != nil || d.Unscaled() != 9999999999 || d.Scale() != 2 {
+		t.Error(d, e)
+	}
+
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(fxInvoice{}), "fx_invoice")
+	if e != nil {
+		t.Fatal(e)
+	}
+	f := ent.FieldByName("Total")
+	if f.DataType != Decimal || f.Precision != 12 || f.Scale != 2 {
+		t.Error(f)
+	}
+	if f = ent.FieldByName("Discount"); f.Precision != DefaultDecimalPrecision || f.Scale != DefaultDecimalScale {
+		t.Error(f)
+	}
+	ts := (&SchemaUpgrader{}).GetSchemaForEntity(ent)
+	if def := mySqlColumnDefinition(ts.ColumnByName("total")); def != "total Decimal(12,2) Not Null" {
+		t.Error(def)
+	}
+	if dt, p, s := sqliteColumnType("DECIMAL_TEXT(12,2)"); dt != Decimal || p != 12 || s != 2 {
+		t.Error(dt, p, s)
+	}
+
+	var inv fxInvoice
+	if e = m.EntityJsonApply(&inv, []byte(`{"Total": 12345678901234.56, "Discount": "0.10", "Reference": 20240001}`)); e != nil {
+		t.Fatal(e)
+	}
+	if inv.Total.String() != "12345678901234.56" || inv.Discount.String() != "0.10" || inv.Reference != "20240001" {
+		t.Error(inv.Total, inv.Discount, inv.Reference)
+	}
+	old := inv
+	inv.Total = NewFixed(1234567890123456, 2)
+	js, _ := m.EntityJsonGet(&inv, &old)
+	if string(js) != `null` {
+		t.Error("same value reported", string(js))
+	}
+	inv.Total = NewFixed(1, 2)
+	js, _ = m.EntityJsonGet(&inv, &old)
+	if string(js) != `{"Id":0,"Total":0.01}` {
+		t.Error(string(js))
+	}
+}
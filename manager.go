@@ -18,10 +18,11 @@ type (
 
 	// GorbConnection define function for data manipulation
 	GorbConnection interface {
-		EntityGet(entity interface{}, pk int64) error
+		EntityGet(entity interface{}, pk interface{}) error
 		EntityPut(entity interface{}) error
-		EntityDelete(eType reflect.Type, pk int64) error
+		EntityDelete(eType reflect.Type, pk interface{}) error
 		EntityQueryIds(request *RequestQuery) ([]int64, error)
+		EntityQueryKeys(request *RequestQuery) ([]interface{}, error)
 		EntityQuery(request *RequestQuery) ([]interface{}, error)
 	}
 
@@ -30,6 +31,19 @@ type (
 		Entities map[reflect.Type]*Entity
 		names    map[string]reflect.Type
 		db       *sql.DB
+
+		// Dialect renders generated SQL. MySqlDialect is used if not set.
+		Dialect Dialect
+
+		// SchemaValidator, if set, validates the schema of the database passed to SetDB.
+		// SetDB returns *SchemaReport if mapped tables do not match the database.
+		SchemaValidator *SchemaUpgrader
+
+		// NamingStrategy derives names of columns with empty tag name and of entities
+		// registered without table name. SnakeCase is used if not set.
+		NamingStrategy NamingStrategy
+		// MapAllFields maps exported fields without gorb tag, gorb:"-" excludes a field
+		MapAllFields bool
 	}
 )
 
@@ -54,19 +68,31 @@ func (mgr *GorbManager) RegisterEntity(class reflect.Type, tableName string) (*E
 			return nil, fmt.Errorf("Type %s is already registered.", class.Name())
 		}
 	}
-	if mgr.names != nil {
-		if _, ok = mgr.names[tableName]; ok {
-			return nil, fmt.Errorf("SQL entity %s is already registered.", tableName)
-		}
-	}
 
 	e := new(Entity)
 	e.init()
-	e.TableName = tableName
+	e.naming, e.mapAllFields = mgr.NamingStrategy, mgr.MapAllFields
+	// tableName may list previous names: "name,was=old_name", empty name is derived from the class name
+	err := e.parseTableName(e.tableNameProps(class, tableName))
+	if err != nil {
+		return nil, err
+	}
+	if mgr.names != nil {
+		if _, ok = mgr.names[e.TableName]; ok {
+			return nil, fmt.Errorf("SQL entity %s is already registered.", e.TableName)
+		}
+	}
 	e.RowClass = class
-	res, err := e.extractGorbSchema(class, []int{}, e)
+	res, err := e.extractGorbSchema(class, []int{}, e, "")
 	if res {
 		res, err = e.check()
+		if res {
+			err = mgr.resolveRelations(e)
+			if err == nil {
+				err = mgr.resolveReferences(e)
+			}
+			res = err == nil
+		}
 		if res {
 			if mgr.Entities == nil {
 				mgr.Entities = make(map[reflect.Type]*Entity, 16)
@@ -116,11 +142,28 @@ func (mgr *GorbManager) EntityByName(name string) (interface{}, error) {
 	return ret, err
 }
 
+func (mgr *GorbManager) dialect() Dialect {
+	if mgr.Dialect == nil {
+		return MySqlDialect{}
+	}
+	return mgr.Dialect
+}
+
 func (mgr *GorbManager) SetDB(db *sql.DB) error {
+	if mgr.SchemaValidator != nil {
+		report, e := mgr.SchemaValidator.validateDB(mgr, db)
+		if e != nil {
+			return e
+		}
+		if !report.IsValid() {
+			return report
+		}
+	}
+
 	mgr.db = db
 
 	for _, ent := range mgr.Entities {
-		e := ent.createStatements(db)
+		e := ent.createStatements(db, mgr.dialect())
 		if e != nil {
 			return e
 		}
@@ -0,0 +1,74 @@
+package gorb
+
+import (
+	"bytes"
+	"unicode"
+)
+
+type (
+	// NamingStrategy derives SQL names of fields and tables that are not named explicitly.
+	// It is used for empty tag names, fields mapped by GorbManager.MapAllFields and
+	// entities registered without table name.
+	NamingStrategy interface {
+		SqlName(goName string) string
+	}
+
+	NamingStrategyFunc func(goName string) string
+)
+
+var (
+	// SnakeCase converts OrderLineID to order_line_id. It is the default strategy.
+	SnakeCase NamingStrategy = NamingStrategyFunc(snakeCase)
+	// LowerCamel converts OrderLineID to orderLineID
+	LowerCamel NamingStrategy = NamingStrategyFunc(lowerCamel)
+	// Identity keeps Go names as they are
+	Identity NamingStrategy = NamingStrategyFunc(func(goName string) string { return goName })
+)
+
+func (f NamingStrategyFunc) SqlName(goName string) string {
+	return f(goName)
+}
+
+// isWordStart reports whether the upper case rune at i starts a new word:
+// after a lower case letter or digit, or as the last capital of an acronym followed by lower case
+func isWordStart(runes []rune, i int) bool {
+	if i == 0 || !unicode.IsUpper(runes[i]) {
+		return false
+	}
+	prev := runes[i-1]
+	if unicode.IsLower(prev) || unicode.IsDigit(prev) {
+		return true
+	}
+	return unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+}
+
+func snakeCase(goName string) string {
+	var runes []rune = []rune(goName)
+	var buffer bytes.Buffer
+	for i, r := range runes {
+		if isWordStart(runes, i) && runes[i-1] != '_' {
+			buffer.WriteRune('_')
+		}
+		buffer.WriteRune(unicode.ToLower(r))
+	}
+	return buffer.String()
+}
+
+func lowerCamel(goName string) string {
+	var runes []rune = []rune(goName)
+	var n int
+	for n < len(runes) && unicode.IsUpper(runes[n]) && (n == 0 || !isWordStart(runes, n)) {
+		n++
+	}
+	for i := 0; i < n; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+func (t *Table) namingStrategy() NamingStrategy {
+	if t.naming == nil {
+		return SnakeCase
+	}
+	return t.naming
+}
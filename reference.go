@@ -0,0 +1,147 @@
+package gorb
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+type (
+	// Reference ties a key field to the primary key of another registered entity, ref=table_name.
+	// load=FieldName names a pointer field of the same struct the referenced entity is loaded into
+	// by EntityGet and EntityQuery. Referenced entities are never stored by EntityPut.
+	Reference struct {
+		TableName string
+		LoadName  string
+		// LoadIdx is the index sequence of the load field, nil if the entity is not loaded
+		LoadIdx []int
+		entity  *Entity
+	}
+)
+
+func (f *Field) parseReference(key, value string) error {
+	if len(value) == 0 {
+		return fmt.Errorf("Field %s: %s expects a value", f.SqlName, key)
+	}
+	if f.Reference == nil {
+		f.Reference = new(Reference)
+	}
+	if key == TagRef {
+		if !isIntegerType(f.DataType) && f.DataType != String {
+			return fmt.Errorf("Field %s: reference has to be integer or String", f.SqlName)
+		}
+		f.Reference.TableName = value
+	} else {
+		f.Reference.LoadName = value
+	}
+	return nil
+}
+
+// resolveReferences looks up referenced entities and load fields of the entity and its child tables.
+// Referenced entities have to be registered first, except the entity itself.
+func (mgr *GorbManager) resolveReferences(ent *Entity) error {
+	var tables []*Table = []*Table{&ent.Table}
+	for _, child := range ent.FlattenChildren() {
+		tables = append(tables, &child.Table)
+	}
+	for _, t := range tables {
+		for _, f := range t.Fields {
+			ref := f.Reference
+			if ref == nil {
+				continue
+			}
+			if len(ref.TableName) == 0 {
+				return fmt.Errorf("Field %s: load requires ref=table_name", f.SqlName)
+			}
+			if ref.TableName == ent.TableName {
+				ref.entity = ent
+			} else if class := mgr.LookupEntityType(ref.TableName); class != nil {
+				ref.entity = mgr.LookupEntity(class)
+			}
+			if ref.entity == nil {
+				return fmt.Errorf("Field %s: referenced entity %s has to be registered first", f.SqlName, ref.TableName)
+			}
+			if (f.DataType == String) != ref.entity.hasStringKey() {
+				return fmt.Errorf("Field %s: type does not match the primary key of %s", f.SqlName, ref.TableName)
+			}
+			if len(ref.LoadName) == 0 {
+				continue
+			}
+
+			// the load field is declared next to the key field
+			var path []int = f.ClassIdx[:len(f.ClassIdx)-1]
+			var class reflect.Type = t.RowClass
+			for _, idx := range path {
+				class = class.Field(idx).Type
+			}
+			sf, ok := class.FieldByName(ref.LoadName)
+			if !ok || sf.Type != reflect.PtrTo(ref.entity.RowClass) {
+				return fmt.Errorf("Field %s: load field %s has to be *%s", f.SqlName, ref.LoadName, ref.entity.RowClass.Name())
+			}
+			ref.LoadIdx = append(append([]int{}, path...), sf.Index...)
+		}
+	}
+	return nil
+}
+
+// populateReferences loads referenced entities into load fields of the row and its child rows.
+// Referenced entities are read without their references and relations.
+func (t *Table) populateReferences(row reflect.Value) error {
+	for _, f := range t.Fields {
+		if f.Reference == nil || f.Reference.LoadIdx == nil {
+			continue
+		}
+		target := row.FieldByIndex(f.Reference.LoadIdx)
+		target.Set(reflect.Zero(target.Type()))
+		key, e := keyOf(row.FieldByIndex(f.ClassIdx))
+		if e != nil {
+			return e
+		}
+		if key.isZero() {
+			continue
+		}
+		refRow := reflect.New(f.Reference.entity.RowClass)
+		e = f.Reference.entity.readRow(refRow.Elem(), key.sqlValue())
+		if e == sql.ErrNoRows {
+			// dangling reference without foreign key
+			continue
+		}
+		if e != nil {
+			return fmt.Errorf("Reference %s[%s]: %v", f.Reference.TableName, key, e)
+		}
+		target.Set(refRow)
+	}
+
+	for _, child := range t.Children {
+		childStorage := row.FieldByIndex(child.ClassIdx)
+		if childStorage.IsNil() {
+			continue
+		}
+		var childRows []reflect.Value
+		switch child.ChildClass.Kind() {
+		case reflect.Ptr:
+			childRows = []reflect.Value{childStorage}
+		case reflect.Slice:
+			for i := 0; i < childStorage.Len(); i++ {
+				childRows = append(childRows, childStorage.Index(i))
+			}
+		case reflect.Map:
+			for _, key := range childStorage.MapKeys() {
+				childRows = append(childRows, childStorage.MapIndex(key))
+			}
+		}
+		for _, childRow := range childRows {
+			if childRow.Kind() == reflect.Ptr {
+				if childRow.IsNil() {
+					continue
+				}
+				childRow = childRow.Elem()
+			}
+			e := child.populateReferences(childRow)
+			if e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
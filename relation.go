@@ -0,0 +1,273 @@
+package gorb
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type (
+	// ManyToMany links entity rows to rows of another entity through a join table.
+	// It is declared with m2m property on a slice of related entities or of their keys:
+	//   Groups  []*Group `gorb:"user_group,m2m"`
+	//   RoleIds []int64  `gorb:"user_role,m2m=user_id:role_id"`
+	// m2m=owner_column:related_column names the join columns. A join table serves one relation of the entity.
+	ManyToMany struct {
+		// TableName is the join table
+		TableName string
+		FieldName string
+		FieldType reflect.Type
+		ClassIdx  []int
+		// RelatedClass is the struct of related entities, nil for slices of keys
+		RelatedClass reflect.Type
+		// OwnerKey and RelatedKey are the join columns
+		OwnerKey   *Field
+		RelatedKey *Field
+		owner      *Entity
+		related    *Entity
+		stmts      *tableStmts
+	}
+)
+
+func hasRelationProperty(props []string) bool {
+	for i := 1; i < len(props); i++ {
+		key, _ := splitProperty(normalizeProperty(props[i]))
+		if key == TagM2M {
+			return true
+		}
+	}
+	return false
+}
+
+func isKeyKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.String:
+		return true
+	}
+	return false
+}
+
+// parseRelation maps many-to-many field declared as "join_table,m2m=owner_column:related_column"
+func (t *Table) parseRelation(ft reflect.StructField, path []int, props []string) (*ManyToMany, error) {
+	if ft.Type.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("Field %s: many-to-many relation has to be a slice", ft.Name)
+	}
+	var rel *ManyToMany = new(ManyToMany)
+	rel.FieldName = ft.Name
+	rel.FieldType = ft.Type
+	rel.ClassIdx = path
+	rel.TableName = strings.TrimSpace(props[0])
+	if len(rel.TableName) == 0 {
+		return nil, fmt.Errorf("Field %s: join table name is required", ft.Name)
+	}
+
+	var ownerColumn, relatedColumn string
+	for _, prop := range props[1:] {
+		key, value := splitProperty(normalizeProperty(prop))
+		if key != TagM2M {
+			return nil, fmt.Errorf("Field %s: unsupported property %s of many-to-many relation", ft.Name, prop)
+		}
+		if len(value) > 0 {
+			columns := strings.Split(value, ":")
+			if len(columns) != 2 || len(columns[0]) == 0 || len(columns[1]) == 0 {
+				return nil, fmt.Errorf("Field %s: m2m expects owner_column:related_column", ft.Name)
+			}
+			ownerColumn, relatedColumn = columns[0], columns[1]
+		}
+	}
+
+	elemType := ft.Type.Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	rel.RelatedKey = new(Field)
+	switch {
+	case elemType.Kind() == reflect.Struct:
+		rel.RelatedClass = elemType
+		if len(relatedColumn) == 0 {
+			relatedColumn = t.namingStrategy().SqlName(elemType.Name() + "Id")
+		}
+	case isKeyKind(elemType.Kind()) && ft.Type.Elem().Kind() != reflect.Ptr:
+		rel.RelatedKey.DataType = getPrimitiveDataType(elemType)
+		if len(relatedColumn) == 0 {
+			// GroupIds keeps keys of group_id column
+			if !strings.HasSuffix(ft.Name, "Ids") && !strings.HasSuffix(ft.Name, "IDs") {
+				return nil, fmt.Errorf("Field %s: related column is required, use m2m=owner_column:related_column", ft.Name)
+			}
+			relatedColumn = t.namingStrategy().SqlName(ft.Name[:len(ft.Name)-1])
+		}
+	default:
+		return nil, fmt.Errorf("Field %s: many-to-many relation expects slice of entities or keys", ft.Name)
+	}
+	rel.RelatedKey.SqlName = relatedColumn
+	rel.OwnerKey = &Field{SqlName: ownerColumn}
+
+	return rel, nil
+}
+
+// resolveRelations sets join column types from primary keys of the owner and related entities.
+// Related entities have to be registered first, except the owner itself.
+func (mgr *GorbManager) resolveRelations(ent *Entity) error {
+	var joinTables map[string]bool = make(map[string]bool, len(ent.Relations))
+	for _, rel := range ent.Relations {
+		// relations sharing a join table would remove each other's join rows
+		var name string = strings.ToLower(rel.TableName)
+		if joinTables[name] {
+			return fmt.Errorf("Join table %s is declared twice in %s", rel.TableName, ent.TableName)
+		}
+		joinTables[name] = true
+		rel.owner = ent
+		if len(rel.OwnerKey.SqlName) == 0 {
+			rel.OwnerKey.SqlName = ent.namingStrategy().SqlName(ent.RowClass.Name() + "Id")
+		}
+		rel.OwnerKey.DataType = ent.PrimaryKey.DataType
+		rel.OwnerKey.Precision = ent.PrimaryKey.Precision
+
+		if rel.RelatedClass != nil {
+			if rel.RelatedClass == ent.RowClass {
+				rel.related = ent
+			} else {
+				rel.related = mgr.LookupEntity(rel.RelatedClass)
+			}
+			if rel.related == nil {
+				return fmt.Errorf("Entity %s of many-to-many relation %s has to be registered first", rel.RelatedClass.Name(), rel.TableName)
+			}
+			rel.RelatedKey.DataType = rel.related.PrimaryKey.DataType
+			rel.RelatedKey.Precision = rel.related.PrimaryKey.Precision
+		} else if rel.RelatedKey.DataType == String {
+			rel.RelatedKey.Precision = rel.OwnerKey.Precision
+		}
+		if strings.EqualFold(rel.OwnerKey.SqlName, rel.RelatedKey.SqlName) {
+			return fmt.Errorf("Join columns of %s are both named %s, use m2m=owner_column:related_column", rel.TableName, rel.OwnerKey.SqlName)
+		}
+	}
+	return nil
+}
+
+// relatedKeys returns the keys of related rows stored in the relation field
+func (rel *ManyToMany) relatedKeys(row reflect.Value) ([]rowKey, error) {
+	var slice reflect.Value = row.FieldByIndex(rel.ClassIdx)
+	var keys []rowKey = make([]rowKey, 0, slice.Len())
+	for i := 0; i < slice.Len(); i++ {
+		elem := slice.Index(i)
+		var key rowKey
+		var e error
+		if rel.related != nil {
+			if elem.Kind() == reflect.Ptr {
+				if elem.IsNil() {
+					continue
+				}
+				elem = elem.Elem()
+			}
+			key, e = rel.related.getKey(elem)
+		} else {
+			key, e = keyOf(elem)
+		}
+		if e != nil {
+			return nil, e
+		}
+		if key.isZero() {
+			return nil, fmt.Errorf("Related row of %s has no key, related entities have to be stored first", rel.TableName)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (rel *ManyToMany) readKeys(stmt *sql.Stmt, pk rowKey) ([]rowKey, error) {
+	rows, e := stmt.Query(pk.sqlValue())
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+	var keys []rowKey = make([]rowKey, 0, 16)
+	for rows.Next() {
+		var key rowKey = fieldKey(rel.RelatedKey)
+		e = rows.Scan(keyScanner{key: &key})
+		if e != nil {
+			return nil, e
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// populateRelations loads keys or entities of many-to-many relations.
+// Related entities are loaded without their references and relations.
+func (conn *GorbManager) populateRelations(ent *Entity, row reflect.Value, pk rowKey) error {
+	for _, rel := range ent.Relations {
+		keys, e := rel.readKeys(rel.stmts.stmtSelect, pk)
+		if e != nil {
+			return e
+		}
+		var slice reflect.Value = reflect.MakeSlice(rel.FieldType, 0, len(keys))
+		for _, key := range keys {
+			elem := reflect.New(rel.FieldType.Elem()).Elem()
+			if rel.related == nil {
+				e = setKey(elem, key)
+			} else {
+				var relatedRow reflect.Value = elem
+				if elem.Kind() == reflect.Ptr {
+					elem.Set(reflect.New(rel.RelatedClass))
+					relatedRow = elem.Elem()
+				}
+				e = conn.entityGet(rel.related, relatedRow, key.sqlValue(), true)
+				if e == sql.ErrNoRows {
+					// join row of a deleted entity, EntityDelete removes only join rows of the owner
+					continue
+				}
+			}
+			if e != nil {
+				return fmt.Errorf("Relation %s[%s]: %v", rel.TableName, key, e)
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		row.FieldByIndex(rel.ClassIdx).Set(slice)
+	}
+	return nil
+}
+
+// storeRelations inserts and removes join rows so that they match the relation fields
+func (ent *Entity) storeRelations(txn *sql.Tx, row reflect.Value, pk rowKey) error {
+	for _, rel := range ent.Relations {
+		keys, e := rel.relatedKeys(row)
+		if e != nil {
+			return e
+		}
+		stored, e := rel.readKeys(txn.Stmt(rel.stmts.stmtSelect), pk)
+		if e != nil {
+			return e
+		}
+		// stored keys are obsolete until found in the field
+		var obsolete map[rowKey]bool = make(map[rowKey]bool, len(stored))
+		for _, key := range stored {
+			obsolete[key] = true
+		}
+
+		stmt := txn.Stmt(rel.stmts.stmtInsert)
+		for _, key := range keys {
+			_, ok := obsolete[key]
+			obsolete[key] = false
+			if ok {
+				// stored or duplicate in the field
+				continue
+			}
+			_, e = stmt.Exec(pk.sqlValue(), key.sqlValue())
+			if e != nil {
+				return e
+			}
+		}
+
+		stmt = txn.Stmt(rel.stmts.stmtRemove)
+		for key, isObsolete := range obsolete {
+			if isObsolete {
+				_, e = stmt.Exec(pk.sqlValue(), key.sqlValue())
+				if e != nil {
+					return e
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package gorb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// KeyGenerator creates primary keys of String primary keys.
+	// It is set with pk=name property, or assigned to Table.KeyGenerator after registration,
+	// and invoked by EntityPut when the key of a new row is empty.
+	KeyGenerator interface {
+		NewKey() (string, error)
+	}
+
+	KeyGeneratorFunc func() (string, error)
+
+	// rowKey is a primary key value of integer or string key.
+	// Composite keys are kept as JSON array in str, so rowKey stays comparable.
+	rowKey struct {
+		id       int64
+		str      string
+		isString bool
+		isTuple  bool
+	}
+
+	keyScanner struct {
+		key *rowKey
+	}
+)
+
+var keyGenerators map[string]KeyGenerator = map[string]KeyGenerator{
+	"uuid4": KeyGeneratorFunc(NewUUIDv4),
+	"uuid7": KeyGeneratorFunc(NewUUIDv7),
+}
+
+func (f KeyGeneratorFunc) NewKey() (string, error) {
+	return f()
+}
+
+// RegisterKeyGenerator makes generator available as pk=name property.
+// It has to be called before the entities using it are registered.
+func RegisterKeyGenerator(name string, generator KeyGenerator) {
+	keyGenerators[strings.ToLower(name)] = generator
+}
+
+func formatUUID(b []byte) string {
+	var s string = hex.EncodeToString(b)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// NewUUIDv4 returns random UUID
+func NewUUIDv4() (string, error) {
+	var b []byte = make([]byte, 16)
+	_, e := rand.Read(b)
+	if e != nil {
+		return "", e
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b), nil
+}
+
+// NewUUIDv7 returns UUID that starts with the current Unix time in milliseconds,
+// so keys generated later sort after earlier ones
+func NewUUIDv7() (string, error) {
+	var b []byte = make([]byte, 16)
+	_, e := rand.Read(b[6:])
+	if e != nil {
+		return "", e
+	}
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(b[0:6], ms[2:])
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b), nil
+}
+
+func (k rowKey) isZero() bool {
+	if k.isString || k.isTuple {
+		return len(k.str) == 0
+	}
+	return k.id == 0
+}
+
+func (k rowKey) less(other rowKey) bool {
+	if k.isString || k.isTuple {
+		return k.str < other.str
+	}
+	return k.id < other.id
+}
+
+// sqlValue returns the key as statement parameter
+func (k rowKey) sqlValue() interface{} {
+	if k.isString {
+		return k.str
+	}
+	return k.id
+}
+
+// sqlValues returns the key columns as statement parameters
+func (k rowKey) sqlValues() []interface{} {
+	if !k.isTuple {
+		return []interface{}{k.sqlValue()}
+	}
+	var parts []interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(k.str)))
+	decoder.UseNumber()
+	decoder.Decode(&parts)
+	for i, part := range parts {
+		if n, ok := part.(json.Number); ok {
+			parts[i], _ = n.Int64()
+		}
+	}
+	return parts
+}
+
+func (k rowKey) String() string {
+	if k.isString || k.isTuple {
+		return k.str
+	}
+	return strconv.FormatInt(k.id, 10)
+}
+
+// tupleKey combines the parts of composite key
+func tupleKey(parts []rowKey) rowKey {
+	var values []interface{} = make([]interface{}, len(parts))
+	for i, part := range parts {
+		values[i] = part.sqlValue()
+	}
+	b, _ := json.Marshal(values)
+	return rowKey{str: string(b), isTuple: true}
+}
+
+func (ks keyScanner) Scan(value interface{}) (err error) {
+	if ks.key.isString {
+		ks.key.str, err = parseString(value)
+	} else {
+		ks.key.id, err = parseInt(value)
+	}
+	return
+}
+
+func (t *Table) hasStringKey() bool {
+	return t.PrimaryKey.DataType == String
+}
+
+func (t *Table) zeroKey() rowKey {
+	return rowKey{isString: t.hasStringKey(), isTuple: t.hasCompositeKey()}
+}
+
+func fieldKey(f *Field) rowKey {
+	return rowKey{isString: f.DataType == String}
+}
+
+// parseKey converts key value of JSON document or query parameter,
+// composite keys are JSON arrays as returned by rowKey.String
+func (t *Table) parseKey(value interface{}) (key rowKey, e error) {
+	if !t.hasCompositeKey() {
+		key = t.zeroKey()
+		e = keyScanner{key: &key}.Scan(value)
+		return
+	}
+	var parts []interface{}
+	switch v := value.(type) {
+	case string:
+		decoder := json.NewDecoder(bytes.NewReader([]byte(v)))
+		decoder.UseNumber()
+		e = decoder.Decode(&parts)
+	case []interface{}:
+		parts = v
+	default:
+		e = fmt.Errorf("Cannot convert to composite key: %T", value)
+	}
+	if e == nil && len(parts) != len(t.KeyFields) {
+		e = fmt.Errorf("Composite key of %s expects %d values", t.TableName, len(t.KeyFields))
+	}
+	if e != nil {
+		return
+	}
+	var keys []rowKey = make([]rowKey, len(parts))
+	for i, part := range parts {
+		keys[i] = fieldKey(t.KeyFields[i])
+		e = keyScanner{key: &keys[i]}.Scan(part)
+		if e != nil {
+			return
+		}
+	}
+	return tupleKey(keys), nil
+}
+
+// keyOfJson reads the key from the fields of JSON row, zero key if a key field is missing
+func (t *Table) keyOfJson(js map[string]interface{}) (rowKey, error) {
+	var parts []interface{} = make([]interface{}, len(t.KeyFields))
+	for i, kf := range t.KeyFields {
+		v, ok := js[kf.FieldName]
+		if !ok {
+			return t.zeroKey(), nil
+		}
+		parts[i] = v
+	}
+	if t.hasCompositeKey() {
+		return t.parseKey(parts)
+	}
+	return t.parseKey(parts[0])
+}
+
+// scanKey reads key columns selected by the info query
+func (t *Table) scanKey(rows *sql.Rows) (rowKey, error) {
+	var parts []rowKey = make([]rowKey, len(t.KeyFields))
+	var dest []interface{} = make([]interface{}, len(t.KeyFields))
+	for i, kf := range t.KeyFields {
+		parts[i] = fieldKey(kf)
+		dest[i] = keyScanner{key: &parts[i]}
+	}
+	e := rows.Scan(dest...)
+	if e != nil || !t.hasCompositeKey() {
+		return parts[0], e
+	}
+	return tupleKey(parts), nil
+}
+
+// keyOf reads integer or string key field
+func keyOf(v reflect.Value) (key rowKey, e error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			key.isString = v.Type().Elem().Kind() == reflect.String
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		key.id = v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		key.id = int64(v.Uint())
+	case reflect.String:
+		key.str = v.String()
+		key.isString = true
+	default:
+		e = fmt.Errorf("Unsupported Primary Key type %s", v.Type())
+	}
+	return
+}
+
+// setKey stores key into integer or string key field
+func setKey(v reflect.Value, key rowKey) error {
+	if key.isTuple {
+		return fmt.Errorf("Cannot store composite key %s into %s", key.str, v.Type())
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if key.isString {
+			return fmt.Errorf("Cannot store key %s into %s", key.str, v.Type())
+		}
+		v.SetInt(key.id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if key.isString {
+			return fmt.Errorf("Cannot store key %s into %s", key.str, v.Type())
+		}
+		v.SetUint(uint64(key.id))
+	case reflect.String:
+		v.SetString(key.String())
+	default:
+		return fmt.Errorf("Unsupported Primary Key type %s", v.Type())
+	}
+	return nil
+}
+
+func (t *Table) getKey(row reflect.Value) (rowKey, error) {
+	if !t.hasCompositeKey() {
+		return keyOf(row.FieldByIndex(t.PrimaryKey.ClassIdx))
+	}
+	var parts []rowKey = make([]rowKey, len(t.KeyFields))
+	for i, kf := range t.KeyFields {
+		part, e := keyOf(row.FieldByIndex(kf.ClassIdx))
+		if e != nil {
+			return part, e
+		}
+		parts[i] = part
+	}
+	return tupleKey(parts), nil
+}
+
+// mapKey returns the key of map children, composite keys are copied into the struct key
+func (c *ChildTable) mapKey(row reflect.Value) reflect.Value {
+	if !c.hasCompositeKey() {
+		return row.FieldByIndex(c.PrimaryKey.ClassIdx)
+	}
+	var key reflect.Value = reflect.New(c.ChildClass.Key()).Elem()
+	for _, kf := range c.KeyFields {
+		key.FieldByName(kf.FieldName).Set(row.FieldByIndex(kf.ClassIdx))
+	}
+	return key
+}
@@ -0,0 +1,203 @@
+package gorb
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type (
+	rkDocument struct {
+		Id    string      `gorb:"id,pk=uuid7"`
+		Title string      `gorb:"title,:100"`
+		Notes []*rkNote   `gorb:"rk_note"`
+		Tags  []*rkTagRow `gorb:"rk_tag"`
+	}
+
+	rkNote struct {
+		Id     string `gorb:"id,pk=uuid4"`
+		DocId  string `gorb:"doc_id,fk"`
+		Remark string `gorb:"remark"`
+	}
+
+	rkTagRow struct {
+		Id    int64  `gorb:"id,pk"`
+		DocId string `gorb:"doc_id,fk"`
+		Tag   string `gorb:"tag"`
+	}
+
+	rkOrder struct {
+		Id     int64                        `gorb:"id,pk"`
+		Lines  []*rkOrderLine               `gorb:"rk_order_line"`
+		Prices map[rkPriceKey]*rkOrderPrice `gorb:"rk_order_price"`
+	}
+
+	rkOrderLine struct {
+		OrderId int64  `gorb:"order_id,fk,pk"`
+		LineNo  int32  `gorb:"line_no,pk"`
+		Sku     string `gorb:"sku,:20"`
+	}
+
+	rkPriceKey struct {
+		OrderId  int64
+		Currency string
+	}
+
+	rkOrderPrice struct {
+		OrderId  int64  `gorb:"order_id,fk,pk"`
+		Currency string `gorb:"currency,pk,:3"`
+		Amount   Fixed  `gorb:"amount,:12.2"`
+	}
+)
+
+var _ GorbConnection = (*GorbManager)(nil)
+
+func TestStringKeys(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-([47])[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	k4, _ := NewUUIDv4()
+	k7, _ := NewUUIDv7()
+	if m := uuid.FindStringSubmatch(k4); m == nil || m[1] != "4" {
+		t.Error(k4)
+	}
+	if m := uuid.FindStringSubmatch(k7); m == nil || m[1] != "7" {
+		t.Error(k7)
+	}
+
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(rkDocument{}), "rk_document")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if ent.IsPkSerial || ent.KeyGenerator == nil || ent.PrimaryKey.Precision != 36 {
+		t.Error("pk=uuid7", ent.PrimaryKey)
+	}
+	type rkBad struct {
+		Id int64 `gorb:"id,pk=uuid4"`
+	}
+	if _, e = m.RegisterEntity(reflect.TypeOf(rkBad{}), "rk_bad"); e == nil {
+		t.Error("generator for integer key accepted")
+	}
+
+	var data entityData
+	for _, id := range []string{"c", "a", "b"} {
+		data.children = append(data.children, rowData{tableNo: 1, pk: rowKey{str: id, isString: true}})
+	}
+	data.children = append(data.children, rowData{tableNo: 2, pk: rowKey{id: 5}})
+	sort.Sort(data.children)
+	if !data.hasRow(1, rowKey{str: "b", isString: true}) || data.hasRow(1, rowKey{str: "d", isString: true}) || !data.hasRow(2, rowKey{id: 5}) {
+		t.Error("findRow", data.children)
+	}
+
+	var note rkNote
+	row := reflect.ValueOf(&note).Elem()
+	notes := ent.ChildByName("rk_note")
+	if e = setKey(row.FieldByIndex(notes.ParentKey.ClassIdx), rowKey{str: k7, isString: true}); e != nil || note.DocId != k7 {
+		t.Error(e, note.DocId)
+	}
+	if e = setKey(reflect.ValueOf(&data.pk.id).Elem(), rowKey{str: k7, isString: true}); e == nil {
+		t.Error("string key stored into int64")
+	}
+
+	doc := &rkDocument{Id: k7, Notes: []*rkNote{{Id: "n1", DocId: k7, Remark: "one"}, {Id: "n2", DocId: k7, Remark: "two"}}}
+	cl, _ := m.EntityClone(doc)
+	old := cl.(*rkDocument)
+	doc.Notes = doc.Notes[1:]
+	doc.Notes[0].Remark = "changed"
+	js, _ := m.EntityJsonGet(doc, old)
+	if !strings.Contains(string(js), `"rk_note[n1]":null`) || !strings.Contains(string(js), `"Remark":"changed"`) {
+		t.Error(string(js))
+	}
+
+	if e = m.EntityJsonApply(old, []byte(`{"rk_note[n2]": null, "rk_note": [{"Id": "n1", "Remark": "uno"}]}`)); e != nil {
+		t.Fatal(e)
+	}
+	if len(old.Notes) != 1 || old.Notes[0].Id != "n1" || old.Notes[0].Remark != "uno" {
+		t.Error(old.Notes)
+	}
+}
+
+func TestCompositeKeys(t *testing.T) {
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(rkOrder{}), "rk_order")
+	if e != nil {
+		t.Fatal(e)
+	}
+	lines := ent.ChildByName("rk_order_line")
+	if lines.IsPkSerial || len(lines.KeyFields) != 2 || !lines.hasCompositeKey() {
+		t.Fatal("composite key", lines.KeyFields)
+	}
+
+	var pg PostgresDialect
+	if q := lines.getInsertQuery(pg); q != `INSERT INTO "rk_order_line"("order_id", "line_no", "sku") VALUES ($1, $2, $3)` {
+		t.Error(q)
+	}
+	if q := lines.getUpdateQuery(pg); q != `UPDATE "rk_order_line" SET "sku"=$1 WHERE "order_id"=$2 AND "line_no"=$3` {
+		t.Error(q)
+	}
+	if q := lines.getRemoveQuery(pg); q != `DELETE FROM "rk_order_line" WHERE "order_id"=$1 AND "line_no"=$2` {
+		t.Error(q)
+	}
+	if q := lines.getInfoQuery(pg, nil); q != `SELECT "order_id", "line_no" FROM "rk_order_line" WHERE "order_id" = $1` {
+		t.Error(q)
+	}
+
+	su := &SchemaUpgrader{}
+	ts := su.GetSchemaForChild(lines)
+	var my MySqlSchemaUpgrader
+	script, _ := my.ScriptOperation(&SchemaOperation{Type: OperationCreateTable, Schema: ts})
+	if !strings.Contains(script[0], "Primary Key(order_id, line_no)") || strings.Contains(script[0], "Auto_Increment") {
+		t.Error(script[0])
+	}
+	var lite SqliteSchemaUpgrader
+	script, _ = lite.ScriptOperation(&SchemaOperation{Type: OperationCreateTable, Schema: ts})
+	if !strings.Contains(script[0], "PRIMARY KEY(order_id, line_no)") || strings.Contains(script[0], "AUTOINCREMENT") {
+		t.Error(script[0])
+	}
+
+	line := &rkOrderLine{OrderId: 7, LineNo: 2}
+	key, e := lines.getKey(reflect.ValueOf(line).Elem())
+	if e != nil || key.String() != "[7,2]" {
+		t.Fatal(e, key)
+	}
+	if parsed, e := lines.parseKey(key.String()); e != nil || parsed != key {
+		t.Error(e, parsed)
+	}
+	if values := key.sqlValues(); len(values) != 2 || values[0] != int64(7) || values[1] != int64(2) {
+		t.Error(values)
+	}
+	if _, e = lines.parseKey("[7]"); e == nil {
+		t.Error("incomplete composite key accepted")
+	}
+
+	order := &rkOrder{Id: 7, Lines: []*rkOrderLine{{OrderId: 7, LineNo: 1, Sku: "A"}, line}}
+	cl, _ := m.EntityClone(order)
+	old := cl.(*rkOrder)
+	order.Lines = order.Lines[1:]
+	order.Lines[0].Sku = "B"
+	js, _ := m.EntityJsonGet(order, old)
+	if !strings.Contains(string(js), `"rk_order_line[[7,1]]":null`) || !strings.Contains(string(js), `"Sku":"B"`) {
+		t.Error(string(js))
+	}
+	if e = m.EntityJsonApply(old, []byte(`{"rk_order_line[[7,1]]": null, "rk_order_line": [{"OrderId": 7, "LineNo": 2, "Sku": "C"}]}`)); e != nil {
+		t.Fatal(e)
+	}
+	if len(old.Lines) != 1 || old.Lines[0].LineNo != 2 || old.Lines[0].Sku != "C" {
+		t.Error(old.Lines)
+	}
+
+	prices := ent.ChildByName("rk_order_price")
+	price := &rkOrderPrice{OrderId: 7, Currency: "EUR"}
+	if k := prices.mapKey(reflect.ValueOf(price).Elem()).Interface(); k != (rkPriceKey{7, "EUR"}) {
+		t.Error(k)
+	}
+
+	type rkBadKey struct {
+		Id     int64                    `gorb:"id,pk"`
+		Prices map[string]*rkOrderPrice `gorb:"rk_order_price"`
+	}
+	if _, e = m.RegisterEntity(reflect.TypeOf(rkBadKey{}), "rk_bad_key"); e == nil {
+		t.Error("string map key accepted for composite key")
+	}
+}
@@ -3,6 +3,7 @@ package gorb
 import (
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 type DataType uint32
@@ -18,8 +19,50 @@ const (
 	DateTime
 	String
 	Blob
+	Decimal
+	Int8
+	Int16
+	Json
 )
 
+func (dt DataType) String() string {
+	switch dt {
+	case Bool:
+		return "Bool"
+	case Int32:
+		return "Int32"
+	case Int64:
+		return "Int64"
+	case Float:
+		return "Float"
+	case DateTime:
+		return "DateTime"
+	case String:
+		return "String"
+	case Blob:
+		return "Blob"
+	case Decimal:
+		return "Decimal"
+	case Int8:
+		return "Int8"
+	case Int16:
+		return "Int16"
+	case Json:
+		return "Json"
+	}
+	return "Unsupported"
+}
+
+// parseDataType parses DataType name as returned by String, case is ignored
+func parseDataType(name string) DataType {
+	for dt := Bool; dt <= Json; dt++ {
+		if strings.EqualFold(dt.String(), name) {
+			return dt
+		}
+	}
+	return Unsupported
+}
+
 type (
 	FieldPropertyParser interface {
 		ParseFieldProperty(property string, field *Field) error
@@ -31,21 +74,54 @@ type (
 		FieldType  reflect.Type
 		SqlName    string
 		Precision  uint16
+		Scale      uint16
 		IsNullable bool
 		IsIndex    bool
+		IsUnique   bool
 		IsRequired bool
-		ClassIdx   []int
+		IsUnsigned bool
+		// IsValuer is set for sql.Scanner and driver.Valuer field types
+		IsValuer   bool
+		HasDefault bool
+		Default    string
+		// Reference is set for keys of other entities declared with ref=table_name
+		Reference *Reference
+		// Rules are validation rules declared with min, max, len, pattern and oneof
+		Rules *ValidationRules
+		// PreviousNames are former SqlNames declared with was=name
+		PreviousNames []string
+		ClassIdx      []int
+	}
+
+	// Index is a composite index declared with index=name or unique=name properties.
+	// Fields are kept in declaration order.
+	Index struct {
+		Name     string
+		Fields   []*Field
+		IsUnique bool
 	}
 
 	Table struct {
 		TableName  string
 		Fields     []*Field
 		PrimaryKey *Field
+		// KeyFields are the primary key fields in declaration order, child tables may have composite keys.
+		// PrimaryKey is the first of them.
+		KeyFields  []*Field
 		Children   []*ChildTable
+		Indice     []*Index
 		RowClass   reflect.Type
 		IsPkSerial bool
-		tableNo    int32
-		stmts      *tableStmts
+		// KeyGenerator creates String primary keys of inserted rows, pk=uuid4 or pk=uuid7
+		KeyGenerator KeyGenerator
+		// Relations are many-to-many relations of entities
+		Relations []*ManyToMany
+		// PreviousNames are former table names declared with was=name
+		PreviousNames []string
+		tableNo       int32
+		stmts         *tableStmts
+		naming        NamingStrategy
+		mapAllFields  bool
 	}
 
 	ChildTable struct {
@@ -53,6 +129,9 @@ type (
 		ParentKey  *Field
 		ClassIdx   []int
 		ChildClass reflect.Type
+		// OnDeleteCascade is set by fk=cascade and applies to the foreign key constraint
+		OnDeleteCascade bool
+		parent          *Table
 	}
 
 	Entity struct {
@@ -65,6 +144,7 @@ type (
 func (t *Table) init() {
 	t.Fields = make([]*Field, 0, 32)
 	t.Children = make([]*ChildTable, 0, 8)
+	t.Indice = make([]*Index, 0, 4)
 }
 
 func (t *Table) FieldByName(name string) *Field {
@@ -76,6 +156,15 @@ func (t *Table) FieldByName(name string) *Field {
 	return nil
 }
 
+func (t *Table) IndexByName(name string) *Index {
+	for _, idx := range t.Indice {
+		if idx.Name == name {
+			return idx
+		}
+	}
+	return nil
+}
+
 func (t *Table) ChildByName(name string) *ChildTable {
 	for _, ch := range t.Children {
 		if ch.TableName == name {
@@ -85,6 +174,38 @@ func (t *Table) ChildByName(name string) *ChildTable {
 	return nil
 }
 
+func (t *Table) hasCompositeKey() bool {
+	return len(t.KeyFields) > 1
+}
+
+func (t *Table) isKeyField(f *Field) bool {
+	for _, kf := range t.KeyFields {
+		if kf == f {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMapKey verifies that map children with composite key are keyed by a struct
+// having a field of the same name and type for every key field
+func (c *ChildTable) checkMapKey() error {
+	var keyType reflect.Type = c.ChildClass.Key()
+	if !c.hasCompositeKey() {
+		return nil
+	}
+	if keyType.Kind() != reflect.Struct {
+		return fmt.Errorf("Map key of %s has to be a struct for composite primary key", c.TableName)
+	}
+	for _, kf := range c.KeyFields {
+		sf, ok := keyType.FieldByName(kf.FieldName)
+		if !ok || sf.Type != kf.FieldType {
+			return fmt.Errorf("Map key %s of %s has no field %s %s", keyType.Name(), c.TableName, kf.FieldName, kf.FieldType)
+		}
+	}
+	return nil
+}
+
 func (t *Table) check() (bool, error) {
 	if t.RowClass == nil {
 		return false, fmt.Errorf("No storage class defined")
@@ -98,11 +219,33 @@ func (t *Table) check() (bool, error) {
 	if t.PrimaryKey == nil {
 		return false, fmt.Errorf("table (%s.%s) has no primary key", t.RowClass.PkgPath(), t.RowClass.Name())
 	}
+	var columns map[string]*Field = make(map[string]*Field, len(t.Fields))
+	for _, f := range t.Fields {
+		// database identifiers are case insensitive
+		name := strings.ToLower(f.SqlName)
+		if other, ok := columns[name]; ok {
+			return false, fmt.Errorf("Column \"%s\" of table \"%s\" is mapped by both %s and %s, use prefix= on embedded structs",
+				f.SqlName, t.TableName, t.fieldPathName(other), t.fieldPathName(f))
+		}
+		columns[name] = f
+	}
 	for _, child := range t.Children {
 		if child.ParentKey == nil {
 			return false, fmt.Errorf("table (%s.%s) has no parent key", child.RowClass.PkgPath(), child.RowClass.Name())
 		}
 
+		if len(child.Relations) > 0 {
+			return false, fmt.Errorf("table %s: many-to-many relations are supported on entities only", child.TableName)
+		}
+		if child.hasCompositeKey() && len(child.Children) > 0 {
+			return false, fmt.Errorf("table %s with composite primary key cannot have child tables", child.TableName)
+		}
+		if child.ChildClass.Kind() == reflect.Map {
+			if e := child.checkMapKey(); e != nil {
+				return false, e
+			}
+		}
+
 		res, er := child.check()
 		if !res {
 			return res, er
@@ -111,6 +254,31 @@ func (t *Table) check() (bool, error) {
 	return true, nil
 }
 
+// fieldPathName names the field with its embedding structs, Billing.Street
+func (t *Table) fieldPathName(f *Field) string {
+	return t.indexPathName(f.ClassIdx)
+}
+
+// indexPathName names the field at index sequence of RowClass
+func (t *Table) indexPathName(index []int) string {
+	var names []string = make([]string, len(index))
+	var class reflect.Type = t.RowClass
+	for i, idx := range index {
+		if class.Kind() == reflect.Ptr {
+			class = class.Elem()
+		}
+		sf := class.Field(idx)
+		names[i] = sf.Name
+		class = sf.Type
+	}
+	return strings.Join(names, ".")
+}
+
+// Parent returns the table the child rows belong to
+func (t *ChildTable) Parent() *Table {
+	return t.parent
+}
+
 func (t *ChildTable) flatten(path []*ChildTable) []*ChildTable {
 	path = append(path, t)
 	for _, child := range t.Children {
@@ -1,44 +1,343 @@
 package gorb
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCurrentTimestamp is the normalized default of columns set to the current time
+const DefaultCurrentTimestamp = "CURRENT_TIMESTAMP"
+
 type (
 	DbSchemaUpgrader interface {
+		// GetVersion returns the last applied migration, 0 for a fresh database or -1 on failure
 		GetVersion() int32
 		SetVersion(version int32) error
+		ExecQuery(query string) error
 		ReadTableSchema(tableName string) (*TableSchema, error)
+		ReadTableNames() ([]string, error)
 		CreateTable(schema *TableSchema) error
 		AlterTableAddColumn(tableName string, column *ColumnSchema) error
 		AlterTableAddIndex(tableName string, index *IndexSchema) error
+		AlterTableModifyColumn(tableName string, column *ColumnSchema) error
+		AlterTableDropColumn(tableName string, columnName string) error
+		AlterTableDropIndex(tableName string, indexName string) error
+		AlterTableAddForeignKey(tableName string, fk *ForeignKeySchema) error
+		AlterTableDropForeignKey(tableName string, fk *ForeignKeySchema) error
+		AlterTableRenameColumn(tableName string, oldName string, newName string) error
+		RenameTable(oldName string, newName string) error
+		DropTable(tableName string) error
+		// ScriptOperation renders the statements of a planned operation without executing them
+		ScriptOperation(op *SchemaOperation) ([]string, error)
 	}
 
 	ColumnSchema struct {
-		Name      string
-		Type      DataType
-		IsNull    bool
-		Precision uint16
+		Name       string
+		Type       DataType
+		IsNull     bool
+		Precision  uint16
+		Scale      uint16
+		IsUnsigned bool
+		HasDefault bool
+		// Default is normalized with normalizeDefault
+		Default       string
+		PreviousNames []string
+		// declaredType is the column type read from the database, table rebuilds keep it
+		declaredType string
 	}
 	IndexSchema struct {
 		Name     string
-		Column   *ColumnSchema
+		Columns  []*ColumnSchema
 		IsUnique bool
 	}
+	// ForeignKeySchema is a referential constraint from Columns to RefColumns of RefTable
+	ForeignKeySchema struct {
+		Name            string
+		Columns         []*ColumnSchema
+		RefTable        string
+		RefColumns      []string
+		OnDeleteCascade bool
+	}
 	TableSchema struct {
-		Name       string
-		PrimaryKey *ColumnSchema
-		ForeignKey *ColumnSchema
-		Columns    []*ColumnSchema
-		Indice     []*IndexSchema
+		Name          string
+		PrimaryKey    *ColumnSchema
+		ForeignKey    *ColumnSchema
+		Columns       []*ColumnSchema
+		Indice        []*IndexSchema
+		ForeignKeys   []*ForeignKeySchema
+		PreviousNames []string
+		// KeyColumns are all primary key columns, set for composite keys
+		KeyColumns []*ColumnSchema
+		// IsKeyReferenced is set if foreign key constraints may reference the primary key,
+		// serial keys then keep the signed type of the referencing columns
+		IsKeyReferenced bool
 	}
 )
 
 type (
 	SchemaUpgrader struct {
 		SqlDmlDriver DbSchemaUpgrader
+		// AllowDataLoss permits lossy operations such as narrowing column types or drops
+		AllowDataLoss bool
+		// DropUnmapped plans dropping of columns and indexes that are not declared by the entity
+		DropUnmapped bool
+		// ForeignKeys creates FOREIGN KEY constraints from child tables to their parent tables.
+		// SQLite enforces them only with PRAGMA foreign_keys = ON
+		ForeignKeys bool
+		// LockTimeout limits the wait for the migration lock, DefaultLockTimeout if not set
+		LockTimeout time.Duration
+		migrations  []*Migration
+		lockDepth   int
 	}
 )
 
+// normalizeDefault converts a default value declared in a tag or read from the database
+// into a comparable form: quotes and parentheses are removed, numbers and booleans
+// are formatted canonically and current time functions become DefaultCurrentTimestamp.
+func normalizeDefault(dataType DataType, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	for len(value) > 1 && value[0] == '(' && value[len(value)-1] == ')' {
+		value = strings.TrimSpace(value[1 : len(value)-1])
+	}
+	var isQuoted bool = len(value) > 1 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0]
+	if isQuoted {
+		quote := string(value[0])
+		value = strings.Replace(value[1:len(value)-1], quote+quote, quote, -1)
+	} else {
+		upper := strings.ToUpper(value)
+		if upper == "NOW()" || strings.HasPrefix(upper, DefaultCurrentTimestamp) {
+			return DefaultCurrentTimestamp, nil
+		}
+	}
+
+	switch dataType {
+	case Bool:
+		switch strings.ToLower(value) {
+		case "1", "b'1'", "true":
+			return "1", nil
+		case "0", "b'0'", "false":
+			return "0", nil
+		}
+	case Int8, Int16, Int32, Int64:
+		i64, e := strconv.ParseInt(value, 10, 64)
+		if e == nil {
+			return strconv.FormatInt(i64, 10), nil
+		}
+	case Float:
+		f64, e := strconv.ParseFloat(value, 64)
+		if e == nil {
+			return strconv.FormatFloat(f64, 'g', -1, 64), nil
+		}
+	case Decimal:
+		d, e := ParseFixed(value)
+		if e == nil {
+			return d.Normalize().String(), nil
+		}
+	default:
+		return value, nil
+	}
+	return "", fmt.Errorf("Invalid %s default value %s", dataType, value)
+}
+
+// readDefault normalizes the column default reported by the database, NULL means no default
+func (cs *ColumnSchema) readDefault(value *string) {
+	if value == nil || strings.ToUpper(strings.TrimSpace(*value)) == "NULL" {
+		return
+	}
+	cs.HasDefault = true
+	dflt, e := normalizeDefault(cs.Type, *value)
+	if e != nil {
+		// kept as reported, it will not match the class default
+		dflt = strings.TrimSpace(*value)
+	}
+	cs.Default = dflt
+}
+
+// defaultLiteral renders the column default as SQL literal
+func (cs *ColumnSchema) defaultLiteral() string {
+	switch {
+	case cs.Default == DefaultCurrentTimestamp:
+		return DefaultCurrentTimestamp
+	case cs.Type == Bool || isIntegerType(cs.Type) || cs.Type == Float || cs.Type == Decimal:
+		return cs.Default
+	}
+	return "'" + strings.Replace(cs.Default, "'", "''", -1) + "'"
+}
+
+func (ts *TableSchema) ColumnByName(name string) *ColumnSchema {
+	for _, col := range ts.Columns {
+		if col.Name == name {
+			return col
+		}
+	}
+	return nil
+}
+
+// clone copies the table schema, indexes and foreign keys refer to the copied columns
+func (ts *TableSchema) clone() *TableSchema {
+	var c *TableSchema = new(TableSchema)
+	*c = *ts
+	var columns map[*ColumnSchema]*ColumnSchema = make(map[*ColumnSchema]*ColumnSchema, len(ts.Columns))
+	copyColumn := func(col *ColumnSchema) *ColumnSchema {
+		if col == nil {
+			return nil
+		}
+		cc, ok := columns[col]
+		if !ok {
+			cc = new(ColumnSchema)
+			*cc = *col
+			columns[col] = cc
+		}
+		return cc
+	}
+
+	c.Columns = make([]*ColumnSchema, len(ts.Columns))
+	for i, col := range ts.Columns {
+		c.Columns[i] = copyColumn(col)
+	}
+	c.PrimaryKey = copyColumn(ts.PrimaryKey)
+	c.ForeignKey = copyColumn(ts.ForeignKey)
+	if ts.KeyColumns != nil {
+		c.KeyColumns = make([]*ColumnSchema, len(ts.KeyColumns))
+		for i, col := range ts.KeyColumns {
+			c.KeyColumns[i] = copyColumn(col)
+		}
+	}
+	c.Indice = make([]*IndexSchema, len(ts.Indice))
+	for i, idx := range ts.Indice {
+		is := *idx
+		is.Columns = make([]*ColumnSchema, len(idx.Columns))
+		for j, col := range idx.Columns {
+			is.Columns[j] = copyColumn(col)
+		}
+		c.Indice[i] = &is
+	}
+	c.ForeignKeys = make([]*ForeignKeySchema, len(ts.ForeignKeys))
+	for i, fk := range ts.ForeignKeys {
+		fks := *fk
+		fks.Columns = make([]*ColumnSchema, len(fk.Columns))
+		for j, col := range fk.Columns {
+			fks.Columns[j] = copyColumn(col)
+		}
+		c.ForeignKeys[i] = &fks
+	}
+	return c
+}
+
+// KeyColumnNames returns the names of primary key columns
+func (ts *TableSchema) KeyColumnNames() []string {
+	if len(ts.KeyColumns) == 0 {
+		if ts.PrimaryKey == nil {
+			return nil
+		}
+		return []string{ts.PrimaryKey.Name}
+	}
+	var names []string = make([]string, len(ts.KeyColumns))
+	for i, col := range ts.KeyColumns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+func (ts *TableSchema) hasCompositeKey() bool {
+	return len(ts.KeyColumns) > 1
+}
+
+func (ts *TableSchema) isKeyColumn(col *ColumnSchema) bool {
+	if col == ts.PrimaryKey {
+		return true
+	}
+	for _, kc := range ts.KeyColumns {
+		if kc == col {
+			return true
+		}
+	}
+	return false
+}
+
+// IndexLike returns the index on the same columns, uniqueness is not compared
+func (ts *TableSchema) IndexLike(index *IndexSchema) *IndexSchema {
+	for _, is := range ts.Indice {
+		if is.sameColumns(index) {
+			return is
+		}
+	}
+	return nil
+}
+
+// ForeignKeyLike returns the foreign key on the same columns
+func (ts *TableSchema) ForeignKeyLike(fk *ForeignKeySchema) *ForeignKeySchema {
+	for _, fks := range ts.ForeignKeys {
+		if fks.sameColumns(fk) {
+			return fks
+		}
+	}
+	return nil
+}
+
+func (fk *ForeignKeySchema) ColumnNames() []string {
+	var names []string = make([]string, len(fk.Columns))
+	for i, col := range fk.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+func (fk *ForeignKeySchema) sameColumns(other *ForeignKeySchema) bool {
+	if len(fk.Columns) != len(other.Columns) {
+		return false
+	}
+	for i, col := range fk.Columns {
+		if col.Name != other.Columns[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
+// sameReference compares referenced table, columns and delete rule
+func (fk *ForeignKeySchema) sameReference(other *ForeignKeySchema) bool {
+	if !strings.EqualFold(fk.RefTable, other.RefTable) || fk.OnDeleteCascade != other.OnDeleteCascade {
+		return false
+	}
+	if len(fk.RefColumns) != len(other.RefColumns) {
+		return false
+	}
+	for i, name := range fk.RefColumns {
+		if !strings.EqualFold(name, other.RefColumns[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (is *IndexSchema) ColumnNames() []string {
+	var names []string = make([]string, len(is.Columns))
+	for i, col := range is.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+func (is *IndexSchema) sameColumns(other *IndexSchema) bool {
+	if len(is.Columns) != len(other.Columns) {
+		return false
+	}
+	for i, col := range is.Columns {
+		if col.Name != other.Columns[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
 func (su *SchemaUpgrader) getSchemaForTable(t *Table) *TableSchema {
 	var ts *TableSchema = new(TableSchema)
 	ts.Name = t.TableName
+	ts.PreviousNames = t.PreviousNames
+	ts.IsKeyReferenced = su.ForeignKeys
 	ts.Columns = make([]*ColumnSchema, len(t.Fields))
 	ts.Indice = make([]*IndexSchema, 0, 8)
 	for i, f := range t.Fields {
@@ -47,21 +346,50 @@ func (su *SchemaUpgrader) getSchemaForTable(t *Table) *TableSchema {
 		cs.Type = f.DataType
 		cs.IsNull = f.IsNullable
 		cs.Precision = f.Precision
+		cs.Scale = f.Scale
+		cs.IsUnsigned = f.IsUnsigned
+		cs.HasDefault = f.HasDefault
+		cs.Default = f.Default
+		cs.PreviousNames = f.PreviousNames
 		if f == t.PrimaryKey {
 			ts.PrimaryKey = cs
 		}
+		if su.ForeignKeys && f.Reference != nil && f.Reference.entity != nil {
+			// referenced rows are not owned, so they are never deleted with the referencing row
+			var fk *ForeignKeySchema = new(ForeignKeySchema)
+			fk.Name = fmt.Sprintf("%s_%s_FK", strings.ToUpper(ts.Name), strings.ToUpper(cs.Name))
+			fk.Columns = []*ColumnSchema{cs}
+			fk.RefTable = f.Reference.entity.TableName
+			fk.RefColumns = []string{f.Reference.entity.PrimaryKey.SqlName}
+			ts.ForeignKeys = append(ts.ForeignKeys, fk)
+		}
+		if t.hasCompositeKey() && t.isKeyField(f) {
+			ts.KeyColumns = append(ts.KeyColumns, cs)
+		}
 		ts.Columns[i] = cs
 
 		if f.IsIndex {
 			var is *IndexSchema = new(IndexSchema)
 			is.Name = ""
-			is.Column = cs
-			is.IsUnique = false
+			is.Columns = []*ColumnSchema{cs}
+			is.IsUnique = f.IsUnique
 
 			ts.Indice = append(ts.Indice, is)
 		}
 	}
 
+	for _, idx := range t.Indice {
+		var is *IndexSchema = new(IndexSchema)
+		is.Name = fmt.Sprintf("%s_%s_IDX", strings.ToUpper(t.TableName), strings.ToUpper(idx.Name))
+		is.Columns = make([]*ColumnSchema, len(idx.Fields))
+		for i, f := range idx.Fields {
+			is.Columns[i] = ts.ColumnByName(f.SqlName)
+		}
+		is.IsUnique = idx.IsUnique
+
+		ts.Indice = append(ts.Indice, is)
+	}
+
 	return ts
 }
 
@@ -76,18 +404,26 @@ func (su *SchemaUpgrader) GetSchemaForChild(child *ChildTable) *TableSchema {
 	}
 
 	if child.PrimaryKey != child.ParentKey {
-		for _, col := range ts.Columns {
-			if col.Name == child.ParentKey.SqlName {
-				var is *IndexSchema = new(IndexSchema)
-				is.Name = ""
-				is.Column = col
-				is.IsUnique = false
-				ts.Indice = append(ts.Indice, is)
-				break
-			}
+		var is *IndexSchema = new(IndexSchema)
+		is.Name = ""
+		is.Columns = []*ColumnSchema{ts.ForeignKey}
+		is.IsUnique = false
+		if ts.IndexLike(is) == nil {
+			ts.Indice = append(ts.Indice, is)
 		}
 	}
 
+	var parent *Table = child.Parent()
+	if su.ForeignKeys && parent != nil {
+		var fk *ForeignKeySchema = new(ForeignKeySchema)
+		fk.Name = fmt.Sprintf("%s_%s_FK", strings.ToUpper(ts.Name), strings.ToUpper(ts.ForeignKey.Name))
+		fk.Columns = []*ColumnSchema{ts.ForeignKey}
+		fk.RefTable = parent.TableName
+		fk.RefColumns = []string{parent.PrimaryKey.SqlName}
+		fk.OnDeleteCascade = child.OnDeleteCascade
+		ts.ForeignKeys = append(ts.ForeignKeys, fk)
+	}
+
 	return ts
 }
 
@@ -98,57 +434,64 @@ func (su *SchemaUpgrader) GetSchemaForEntity(entity *Entity) *TableSchema {
 	return ts
 }
 
-func (su *SchemaUpgrader) UpgradeEntity(ent *Entity) error {
-
-	children := ent.FlattenChildren()
-	var tables []*TableSchema = make([]*TableSchema, len(children)+1)
-	tables[0] = su.GetSchemaForEntity(ent)
-	for i, child := range children {
-		tables[i+1] = su.GetSchemaForChild(child)
-	}
-
-	for _, classSchema := range tables {
-		dbSchema, e := su.SqlDmlDriver.ReadTableSchema(classSchema.Name)
-
-		if e == nil { // upgrade
-			for _, fsc := range classSchema.Columns {
-				found := false
-				for _, fsdb := range dbSchema.Columns {
-					if fsc.Name == fsdb.Name {
-						found = true
-						break
-					}
-				}
-				if !found {
-					e = su.SqlDmlDriver.AlterTableAddColumn(dbSchema.Name, fsc)
-					if e != nil {
-						return e
-					}
-				}
-			}
+// GetSchemaForRelation returns the join table of many-to-many relation.
+// The primary key consists of both join columns, related column is indexed.
+func (su *SchemaUpgrader) GetSchemaForRelation(rel *ManyToMany) *TableSchema {
+	var ts *TableSchema = new(TableSchema)
+	ts.Name = rel.TableName
+	var keys []*Field = []*Field{rel.OwnerKey, rel.RelatedKey}
+	for _, f := range keys {
+		cs := new(ColumnSchema)
+		cs.Name = f.SqlName
+		cs.Type = f.DataType
+		cs.Precision = f.Precision
+		ts.Columns = append(ts.Columns, cs)
+	}
+	ts.PrimaryKey = ts.Columns[0]
+	ts.ForeignKey = ts.Columns[0]
+	ts.KeyColumns = ts.Columns
+	ts.Indice = []*IndexSchema{{Columns: []*ColumnSchema{ts.Columns[1]}}}
 
-			for _, isc := range classSchema.Indice {
-				found := false
-				for _, isdb := range dbSchema.Indice {
-					if isc.Column.Name == isdb.Column.Name {
-						found = true
-						break
-					}
-				}
-				if !found {
-					e = su.SqlDmlDriver.AlterTableAddIndex(dbSchema.Name, isc)
-					if e != nil {
-						return e
-					}
-				}
-			}
-		} else { // create
-			e = su.SqlDmlDriver.CreateTable(classSchema)
-			if e != nil {
-				return e
+	if su.ForeignKeys {
+		var refTables []*Entity = []*Entity{rel.owner, rel.related}
+		for i, ref := range refTables {
+			if ref == nil {
+				continue
 			}
+			var fk *ForeignKeySchema = new(ForeignKeySchema)
+			fk.Name = fmt.Sprintf("%s_%s_FK", strings.ToUpper(ts.Name), strings.ToUpper(ts.Columns[i].Name))
+			fk.Columns = []*ColumnSchema{ts.Columns[i]}
+			fk.RefTable = ref.TableName
+			fk.RefColumns = []string{ref.PrimaryKey.SqlName}
+			fk.OnDeleteCascade = true
+			ts.ForeignKeys = append(ts.ForeignKeys, fk)
 		}
 	}
 
-	return nil
+	return ts
+}
+
+// getEntitySchemas returns the schemas of entity table, child tables and join tables
+func (su *SchemaUpgrader) getEntitySchemas(ent *Entity) []*TableSchema {
+	children := ent.FlattenChildren()
+	var tables []*TableSchema = make([]*TableSchema, 0, len(children)+len(ent.Relations)+1)
+	tables = append(tables, su.GetSchemaForEntity(ent))
+	for _, child := range children {
+		tables = append(tables, su.GetSchemaForChild(child))
+	}
+	for _, rel := range ent.Relations {
+		tables = append(tables, su.GetSchemaForRelation(rel))
+	}
+	return tables
+}
+
+// UpgradeEntity plans and applies the entity changes holding the migration lock
+func (su *SchemaUpgrader) UpgradeEntity(ent *Entity) error {
+	return su.withLock(func() error {
+		plan, e := su.PlanEntity(ent)
+		if e != nil {
+			return e
+		}
+		return su.ApplyPlan(plan)
+	})
 }
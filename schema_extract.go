@@ -9,21 +9,40 @@ import (
 )
 
 const (
-	TagPrefix string = "gorb"
-	TagPK     string = "pk"    // field: primary key
-	TagFK     string = "fk"    // field: foreign key
-	TagToken  string = "token" // field: sync token
-	TagIndex  string = "index" // field: index
-	TagNull   string = "null"  // field: field accepts null
-	TagReq    string = "req"   // field: required field in serialization
+	TagPrefix       string = "gorb"
+	TagPK           string = "pk"      // field: primary key, pk=generator creates String keys: uuid4, uuid7
+	TagFK           string = "fk"      // field: foreign key, fk=cascade deletes child rows with the parent
+	TagToken        string = "token"   // field: sync token
+	TagIndex        string = "index"   // field: index, index=name groups fields into composite index
+	TagUnique       string = "unique"  // field: unique index, unique=name groups fields into composite unique index
+	TagNull         string = "null"    // field: field accepts null
+	TagReq          string = "req"     // field: required field in serialization and validation
+	TagDefault      string = "default" // field: column default, default=value
+	TagWas          string = "was"     // field, table: previous name, was=name
+	TagType         string = "type"    // field: column type of sql.Scanner field types, type=String
+	TagJson         string = "json"    // field: struct, map or slice stored as JSON document
+	TagColumnPrefix string = "prefix"  // embedded struct: prefix of the column names, prefix=bill_
+	TagM2M          string = "m2m"     // field: many-to-many relation through join table, m2m=owner_column:related_column
+	TagRef          string = "ref"     // field: reference to registered entity, ref=table_name
+	TagLoad         string = "load"    // field: pointer field the referenced entity is loaded into, load=FieldName
+	TagMin          string = "min"     // field: validation, minimal number or string length, min=1
+	TagMax          string = "max"     // field: validation, maximal number or string length, max=100
+	TagLen          string = "len"     // field: validation, exact string length, len=3
+	TagPattern      string = "pattern" // field: validation, regular expression of strings, pattern='^[a-z]+$'
+	TagOneOf        string = "oneof"   // field: validation, allowed values separated by spaces, oneof='new open closed'
+
+	// field: unsigned integer column, implied by uint8 and uint16 fields
+	TagUnsigned string = "unsigned"
 )
 
 var (
 	dateTimeType reflect.Type
+	fixedType    reflect.Type
 )
 
 func init() {
 	dateTimeType = reflect.TypeOf((*time.Time)(nil)).Elem()
+	fixedType = reflect.TypeOf(Fixed{})
 }
 
 func getPrimitiveDataType(t reflect.Type) DataType {
@@ -35,13 +54,17 @@ func getPrimitiveDataType(t reflect.Type) DataType {
 	if dt == dateTimeType {
 		return DateTime
 	}
+	if dt == fixedType {
+		return Decimal
+	}
 
 	switch dt.Kind() {
 	case reflect.Bool:
 		return Bool
-	case reflect.Uint8, reflect.Uint16, reflect.Int8, reflect.Int16:
-		fmt.Printf("short integer fields are not supported")
-
+	case reflect.Int8, reflect.Uint8:
+		return Int8
+	case reflect.Int16, reflect.Uint16:
+		return Int16
 	case reflect.Int, reflect.Uint, reflect.Int64, reflect.Uint64:
 		return Int64
 	case reflect.Int32, reflect.Uint32:
@@ -61,8 +84,89 @@ func getPrimitiveDataType(t reflect.Type) DataType {
 	return Unsupported
 }
 
+// isSmallUnsignedKind reports uint8 and uint16 fields, wider unsigned fields were always mapped
+// to signed columns and declare unsigned columns with the unsigned property
+func isSmallUnsignedKind(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Uint8 || t.Kind() == reflect.Uint16
+}
+
+func hasJsonProperty(props []string) bool {
+	for i := 1; i < len(props); i++ {
+		if normalizeProperty(props[i]) == TagJson {
+			return true
+		}
+	}
+	return false
+}
+
+// splitProperty splits "key=value" field property
+func splitProperty(property string) (key string, value string) {
+	idx := strings.Index(property, "=")
+	if idx < 0 {
+		return property, ""
+	}
+	return strings.TrimSpace(property[:idx]), strings.TrimSpace(property[idx+1:])
+}
+
+func splitPrecision(value string) (precision string, scale string) {
+	idx := strings.Index(value, ".")
+	if idx < 0 {
+		return value, ""
+	}
+	return value[:idx], value[idx+1:]
+}
+
+// normalizeProperty lowercases the property key, values keep their case
+func normalizeProperty(property string) string {
+	property = strings.TrimSpace(property)
+	idx := strings.Index(property, "=")
+	if idx < 0 {
+		return strings.ToLower(property)
+	}
+	return strings.ToLower(property[:idx]) + property[idx:]
+}
+
+// parseTableName parses "name,was=old_name" table declarations
+func (t *Table) parseTableName(props []string) error {
+	t.TableName = strings.TrimSpace(props[0])
+	if len(t.TableName) == 0 {
+		return fmt.Errorf("Empty table name")
+	}
+	for _, prop := range props[1:] {
+		key, value := splitProperty(normalizeProperty(prop))
+		if key != TagWas || len(value) == 0 {
+			return fmt.Errorf("Unsupported property %s for table %s", prop, t.TableName)
+		}
+		t.PreviousNames = append(t.PreviousNames, value)
+	}
+	return nil
+}
+
+// tableNameProps splits "name,was=old_name" table name, empty name is derived from the class name
+func (t *Table) tableNameProps(class reflect.Type, tableName string) []string {
+	var props []string = strings.Split(tableName, ",")
+	if len(strings.TrimSpace(props[0])) == 0 {
+		props[0] = t.namingStrategy().SqlName(class.Name())
+	}
+	return props
+}
+
+func (t *Table) addIndexField(name string, isUnique bool, field *Field) {
+	idx := t.IndexByName(name)
+	if idx == nil {
+		idx = &Index{Name: name, Fields: make([]*Field, 0, 4)}
+		t.Indice = append(t.Indice, idx)
+	}
+	idx.Fields = append(idx.Fields, field)
+	idx.IsUnique = idx.IsUnique || isUnique
+}
+
 func (t *Table) ParseFieldProperty(property string, field *Field) error {
-	if property == TagPK {
+	key, value := splitProperty(property)
+	if key == TagPK {
 		if t.PrimaryKey != nil {
 			return fmt.Errorf("Duplicate primary key definition")
 		}
@@ -71,19 +175,66 @@ func (t *Table) ParseFieldProperty(property string, field *Field) error {
 		} else if field.DataType != String {
 			return fmt.Errorf("Column \"%s\" in table \"%s\" cannot be Primary Key", field.SqlName, t.TableName)
 		}
+		if len(value) > 0 {
+			generator, ok := keyGenerators[strings.ToLower(value)]
+			if !ok || field.DataType != String {
+				return fmt.Errorf("Unsupported key generator %s for field %s", value, field.SqlName)
+			}
+			t.KeyGenerator = generator
+			if field.Precision == 0 {
+				// UUID
+				field.Precision = 36
+			}
+		}
 		t.PrimaryKey = field
+		t.KeyFields = []*Field{field}
 		field.IsRequired = true
-	} else if property == TagIndex {
-		field.IsIndex = true
+	} else if key == TagIndex || key == TagUnique {
+		if len(value) == 0 {
+			field.IsIndex = true
+			field.IsUnique = field.IsUnique || key == TagUnique
+		} else {
+			t.addIndexField(strings.ToLower(value), key == TagUnique, field)
+		}
+	} else if key == TagMin || key == TagMax || key == TagLen || key == TagPattern || key == TagOneOf {
+		return field.parseRule(key, value)
+	} else if key == TagRef || key == TagLoad {
+		return field.parseReference(key, value)
 	} else if property == TagNull {
 		field.IsNullable = true
 	} else if property == TagReq {
 		field.IsRequired = true
+	} else if property == TagUnsigned {
+		if !isIntegerType(field.DataType) {
+			return fmt.Errorf("Field %s: unsigned is supported for integers", field.SqlName)
+		}
+		field.IsUnsigned = true
+	} else if key == TagWas {
+		if len(value) == 0 {
+			return fmt.Errorf("Field %s: previous name expected", field.SqlName)
+		}
+		field.PreviousNames = append(field.PreviousNames, value)
+	} else if key == TagDefault {
+		dflt, e := normalizeDefault(field.DataType, value)
+		if e != nil {
+			return fmt.Errorf("Field %s: %v", field.SqlName, e)
+		}
+		field.HasDefault = true
+		field.Default = dflt
 	} else if strings.HasPrefix(property, ":") {
-		i16, e := strconv.ParseInt(property[1:], 10, 16)
+		// :length or :precision.scale
+		precision, scale := splitPrecision(property[1:])
+		i16, e := strconv.ParseInt(precision, 10, 16)
 		if e == nil {
 			field.Precision = uint16(i16)
 		}
+		if len(scale) > 0 {
+			i16, e = strconv.ParseInt(scale, 10, 16)
+			if e != nil || field.DataType != Decimal {
+				return fmt.Errorf("Invalid precision %s for field %s", property, field.SqlName)
+			}
+			field.Scale = uint16(i16)
+		}
 	} else {
 		return fmt.Errorf("Unsupported property %s for field %s", property, field.SqlName)
 	}
@@ -92,17 +243,40 @@ func (t *Table) ParseFieldProperty(property string, field *Field) error {
 }
 
 func (c *ChildTable) ParseFieldProperty(property string, field *Field) error {
-	if property == TagFK {
+	key, value := splitProperty(property)
+	if key == TagFK {
 		if c.ParentKey != nil {
 			return fmt.Errorf("Duplicate parent key definition")
 		}
+		switch strings.ToLower(value) {
+		case "":
+		case "cascade":
+			c.OnDeleteCascade = true
+		default:
+			return fmt.Errorf("Unsupported foreign key option %s for field %s", value, field.SqlName)
+		}
 		c.ParentKey = field
 		if c.PrimaryKey == c.ParentKey {
 			c.IsPkSerial = false
 		}
+	} else if key == TagPK && c.PrimaryKey != nil {
+		// composite key
+		if len(value) > 0 || c.KeyGenerator != nil {
+			return fmt.Errorf("Key generator is not supported for composite key of %s", c.TableName)
+		}
+		if !isIntegerType(field.DataType) && field.DataType != String {
+			return fmt.Errorf("Column \"%s\" in table \"%s\" cannot be Primary Key", field.SqlName, c.TableName)
+		}
+		c.KeyFields = append(c.KeyFields, field)
+		c.IsPkSerial = false
+		field.IsRequired = true
 	} else {
 		var t *Table = &((*c).Table)
-		return t.ParseFieldProperty(property, field)
+		e := t.ParseFieldProperty(property, field)
+		if e == nil && key == TagPK && c.PrimaryKey == c.ParentKey {
+			c.IsPkSerial = false
+		}
+		return e
 	}
 	return nil
 }
@@ -120,38 +294,138 @@ func (e *Entity) ParseFieldProperty(property string, field *Field) error {
 	return nil
 }
 
-func (t *Table) extractGorbSchema(class reflect.Type, path []int, propertyParser FieldPropertyParser) (bool, error) {
+// fieldPath returns the index sequence of field i, the path of sibling fields must not share the array
+func fieldPath(path []int, i int) []int {
+	var res []int = make([]int, len(path)+1)
+	copy(res, path)
+	res[len(path)] = i
+	return res
+}
+
+// embeddedPrefix returns the column prefix of embedded struct declared as ",prefix=name"
+func embeddedPrefix(ft reflect.StructField, props []string) (string, error) {
+	var prefix string
+	for _, prop := range props[1:] {
+		key, value := splitProperty(normalizeProperty(prop))
+		if key != TagColumnPrefix || len(value) == 0 {
+			return "", fmt.Errorf("Unsupported property %s for embedded struct %s", prop, ft.Name)
+		}
+		prefix = value
+	}
+	return prefix, nil
+}
+
+// extractGorbSchema maps fields of class, prefix is prepended to column names of embedded structs
+func (t *Table) extractGorbSchema(class reflect.Type, path []int, propertyParser FieldPropertyParser, prefix string) (bool, error) {
 	for i := 0; i < class.NumField(); i++ {
 		ft := class.Field(i)
 
-		gorbTag := ft.Tag.Get(TagPrefix)
+		gorbTag, isTagged := ft.Tag.Lookup(TagPrefix)
+		if gorbTag == "-" {
+			continue
+		}
+		if !isTagged && t.mapAllFields && len(ft.PkgPath) == 0 && (getPrimitiveDataType(ft.Type) != Unsupported || isValuerType(ft.Type)) {
+			// sql.Scanner structs are columns, not embedded structs
+			isTagged = true
+		}
+		var embedPrefix string
+		if ft.Type.Kind() == reflect.Struct && getPrimitiveDataType(ft.Type) == Unsupported && !isValuerType(ft.Type) {
+			props := splitTag(gorbTag)
+			if len(strings.TrimSpace(props[0])) == 0 && !hasJsonProperty(props) {
+				// embedded struct
+				var e error
+				embedPrefix, e = embeddedPrefix(ft, props)
+				if e != nil {
+					return false, e
+				}
+				isTagged = false
+			}
+		}
 
-		if len(gorbTag) > 0 {
-			props := strings.Split(gorbTag, ",")
+		if isTagged {
+			props := splitTag(gorbTag)
 			if len(props) == 0 {
 				return false, fmt.Errorf("Invalid GORB tag for field: %s", ft.Name)
 			}
+			if hasRelationProperty(props) {
+				rel, e := t.parseRelation(ft, fieldPath(path, i), props)
+				if e != nil {
+					return false, e
+				}
+				t.Relations = append(t.Relations, rel)
+				continue
+			}
 			dataType := getPrimitiveDataType(ft.Type)
-			if dataType != Unsupported {
+			isValuer := isValuerType(ft.Type)
+			isJson := hasJsonProperty(props)
+			if isJson {
+				dataType, isValuer = Json, false
+			}
+			if dataType != Unsupported || isValuer {
 				fld := new(Field)
 				fld.FieldName = ft.Name
 				fld.DataType = dataType
 				fld.FieldType = ft.Type
 				fld.SqlName = strings.TrimSpace(props[0])
-				fld.ClassIdx = append(path, i)
+				if len(fld.SqlName) == 0 {
+					fld.SqlName = t.namingStrategy().SqlName(ft.Name)
+				}
+				fld.SqlName = prefix + fld.SqlName
+				fld.ClassIdx = fieldPath(path, i)
+				fld.IsValuer = isValuer
 
+				// the column type is parsed first, other properties depend on it
+				var fieldProps []string = make([]string, 0, len(props))
 				for i := 1; i < len(props); i++ {
-					prop := strings.TrimSpace(props[i])
-					prop = strings.ToLower(prop)
+					prop := normalizeProperty(props[i])
+					key, value := splitProperty(prop)
+					if prop == TagJson {
+						continue
+					}
+					if key != TagType {
+						fieldProps = append(fieldProps, prop)
+						continue
+					}
+					if !isValuer {
+						return false, fmt.Errorf("Field %s: type is supported for sql.Scanner types only", fld.SqlName)
+					}
+					fld.DataType = parseDataType(value)
+					if fld.DataType == Unsupported {
+						return false, fmt.Errorf("Field %s: unsupported type %s", fld.SqlName, value)
+					}
+				}
+				if fld.DataType == Unsupported && isValuer {
+					fld.DataType = nullValueType(ft.Type)
+					fld.IsNullable = fld.DataType != Unsupported
+				}
+				if fld.DataType == Unsupported {
+					return false, fmt.Errorf("Field %s: column type of %s is required, use type=", fld.SqlName, ft.Type)
+				}
 
+				for _, prop := range fieldProps {
 					e := propertyParser.ParseFieldProperty(prop, fld)
 					if e != nil {
 						return false, e
 					}
 				}
+				// previous names of embedded fields are declared without the prefix as well
+				for j, name := range fld.PreviousNames {
+					fld.PreviousNames[j] = prefix + name
+				}
 				if fld.FieldType.Kind() == reflect.Ptr {
 					fld.IsNullable = true
 				}
+				if isIntegerType(fld.DataType) && isSmallUnsignedKind(ft.Type) {
+					fld.IsUnsigned = true
+				}
+				if fld.DataType == Decimal {
+					if fld.Precision == 0 {
+						fld.Precision, fld.Scale = DefaultDecimalPrecision, DefaultDecimalScale
+					}
+					if fld.Precision > MaxDecimalPrecision || fld.Scale > fld.Precision {
+						return false, fmt.Errorf("Field %s: unsupported decimal precision %d.%d", fld.SqlName, fld.Precision, fld.Scale)
+					}
+				}
 				t.Fields = append(t.Fields, fld)
 			} else {
 				switch ft.Type.Kind() {
@@ -164,11 +438,19 @@ func (t *Table) extractGorbSchema(class reflect.Type, path []int, propertyParser
 						if chType.Kind() == reflect.Struct {
 							c := new(ChildTable)
 							c.init()
-							c.TableName = props[0]
+							c.naming, c.mapAllFields = t.naming, t.mapAllFields
+							if len(strings.TrimSpace(props[0])) == 0 {
+								props[0] = t.namingStrategy().SqlName(chType.Name())
+							}
+							e := c.parseTableName(props)
+							if e != nil {
+								return false, e
+							}
 							c.ChildClass = ft.Type
 							c.RowClass = chType
-							c.ClassIdx = append(path, i)
-							res, err := c.extractGorbSchema(chType, []int{}, c)
+							c.ClassIdx = fieldPath(path, i)
+							c.parent = t
+							res, err := c.extractGorbSchema(chType, []int{}, c, "")
 							if res {
 								t.Children = append(t.Children, c)
 							} else {
@@ -182,7 +464,7 @@ func (t *Table) extractGorbSchema(class reflect.Type, path []int, propertyParser
 			}
 
 		} else if ft.Type.Kind() == reflect.Struct {
-			res, err := t.extractGorbSchema(ft.Type, append(path, i), propertyParser)
+			res, err := t.extractGorbSchema(ft.Type, fieldPath(path, i), propertyParser, prefix+embedPrefix)
 			if !res {
 				return res, err
 			}
@@ -200,11 +482,22 @@ func (mgr *GorbManager) ExtractEntity(class reflect.Type, tableName string) (*En
 
 	e := new(Entity)
 	e.init()
-	e.TableName = tableName
+	e.naming, e.mapAllFields = mgr.NamingStrategy, mgr.MapAllFields
+	err := e.parseTableName(e.tableNameProps(class, tableName))
+	if err != nil {
+		return nil, err
+	}
 	e.RowClass = class
-	res, err := e.extractGorbSchema(class, []int{}, e)
+	res, err := e.extractGorbSchema(class, []int{}, e, "")
 	if res {
 		res, err = e.check()
+		if res {
+			err = mgr.resolveRelations(e)
+			if err == nil {
+				err = mgr.resolveReferences(e)
+			}
+			res = err == nil
+		}
 		if res {
 			if mgr.Entities == nil {
 				mgr.Entities = make(map[reflect.Type]*Entity, 16)
@@ -0,0 +1,283 @@
+package gorb
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strings"
+	"unicode"
+)
+
+type (
+	// ChildMapping declares Child table as child rows of Parent table.
+	// ForeignKey is the child column referencing the parent, if empty
+	// it is taken from the foreign key constraints of the child table.
+	ChildMapping struct {
+		Parent     string
+		Child      string
+		ForeignKey string
+	}
+
+	// StructGenerator writes gorb tagged Go structs for existing database tables
+	StructGenerator struct {
+		Driver   DbSchemaUpgrader
+		Package  string
+		Children []*ChildMapping
+	}
+)
+
+// goName converts sql name to exported Go identifier: order_line -> OrderLine
+func goName(sqlName string) string {
+	var buffer bytes.Buffer
+	var upper bool = true
+	for _, r := range sqlName {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if buffer.Len() == 0 && unicode.IsDigit(r) {
+			buffer.WriteRune('X')
+		}
+		if upper {
+			buffer.WriteRune(unicode.ToUpper(r))
+			upper = false
+		} else {
+			buffer.WriteRune(r)
+		}
+	}
+	if buffer.Len() == 0 {
+		return "X"
+	}
+	return buffer.String()
+}
+
+func goType(col *ColumnSchema) string {
+	var name string
+	switch col.Type {
+	case Bool:
+		name = "bool"
+	case Int8:
+		name = "int8"
+	case Int16:
+		name = "int16"
+	case Int32:
+		name = "int32"
+	case Int64:
+		name = "int64"
+	case Float:
+		name = "float64"
+	case String:
+		name = "string"
+	case DateTime:
+		name = "time.Time"
+	case Decimal:
+		name = "gorb.Fixed"
+	case Blob:
+		return "[]byte"
+	case Json:
+		return "json.RawMessage"
+	default:
+		return ""
+	}
+	if col.IsUnsigned && isIntegerType(col.Type) {
+		name = "u" + name
+	}
+	if col.IsNull {
+		return "*" + name
+	}
+	return name
+}
+
+// indexGroupName recovers the index=name property from TABLE_NAME_IDX index names
+func indexGroupName(tableName string, index *IndexSchema) string {
+	var name string = strings.ToUpper(index.Name)
+	var prefix string = strings.ToUpper(tableName) + "_"
+	if strings.HasPrefix(name, prefix) && strings.HasSuffix(name, "_IDX") && len(name) > len(prefix)+4 {
+		name = name[len(prefix) : len(name)-4]
+	}
+	return strings.ToLower(name)
+}
+
+func (g *StructGenerator) columnTag(ts *TableSchema, col *ColumnSchema, parentKey *ForeignKeySchema) string {
+	var props []string = []string{col.Name}
+	if ts.isKeyColumn(col) {
+		props = append(props, TagPK)
+	}
+	if parentKey != nil && parentKey.Columns[0].Name == col.Name {
+		if parentKey.OnDeleteCascade {
+			props = append(props, TagFK+"=cascade")
+		} else {
+			props = append(props, TagFK)
+		}
+	}
+	if col.IsNull && !ts.isKeyColumn(col) {
+		props = append(props, TagNull)
+	}
+	if col.Type == String && col.Precision > 0 {
+		props = append(props, fmt.Sprintf(":%d", col.Precision))
+	}
+	if col.Type == Decimal {
+		props = append(props, fmt.Sprintf(":%d.%d", col.Precision, col.Scale))
+	}
+	if col.Type == Json {
+		props = append(props, TagJson)
+	}
+	if col.IsUnsigned && (col.Type == Int32 || col.Type == Int64) && !ts.isKeyColumn(col) {
+		props = append(props, TagUnsigned)
+	}
+	for _, idx := range ts.Indice {
+		var tag string = TagIndex
+		if idx.IsUnique {
+			tag = TagUnique
+		}
+		for _, ic := range idx.Columns {
+			if ic.Name != col.Name {
+				continue
+			}
+			if len(idx.Columns) == 1 {
+				props = append(props, tag)
+			} else {
+				props = append(props, tag+"="+indexGroupName(ts.Name, idx))
+			}
+		}
+	}
+	if col.HasDefault {
+		literal := col.defaultLiteral()
+		// tag properties are comma separated
+		if !strings.ContainsAny(literal, ",`\"") {
+			props = append(props, TagDefault+"="+literal)
+		}
+	}
+	return strings.Join(props, ",")
+}
+
+// parentKey finds the foreign key of a child table
+func (g *StructGenerator) parentKey(cm *ChildMapping, ts *TableSchema) (*ForeignKeySchema, error) {
+	for _, fk := range ts.ForeignKeys {
+		if len(fk.Columns) != 1 {
+			continue
+		}
+		if len(cm.ForeignKey) > 0 {
+			if fk.Columns[0].Name == cm.ForeignKey {
+				return fk, nil
+			}
+		} else if strings.EqualFold(fk.RefTable, cm.Parent) {
+			return fk, nil
+		}
+	}
+	if len(cm.ForeignKey) > 0 {
+		col := ts.ColumnByName(cm.ForeignKey)
+		if col != nil {
+			return &ForeignKeySchema{Columns: []*ColumnSchema{col}, RefTable: cm.Parent}, nil
+		}
+		return nil, fmt.Errorf("Column %s does not exist in table %s", cm.ForeignKey, ts.Name)
+	}
+	return nil, fmt.Errorf("Table %s has no foreign key to %s", ts.Name, cm.Parent)
+}
+
+func (g *StructGenerator) writeStruct(buffer *bytes.Buffer, ts *TableSchema, parentKey *ForeignKeySchema) {
+	if ts.PrimaryKey == nil {
+		buffer.WriteString(fmt.Sprintf("// %s has no primary key\n", ts.Name))
+	}
+	buffer.WriteString(fmt.Sprintf("type %s struct {\n", goName(ts.Name)))
+	for _, col := range ts.Columns {
+		typeName := goType(col)
+		if len(typeName) == 0 {
+			buffer.WriteString(fmt.Sprintf("\t// %s: unsupported column type\n", col.Name))
+			continue
+		}
+		if g.Package == "gorb" {
+			typeName = strings.Replace(typeName, "gorb.", "", 1)
+		}
+		buffer.WriteString(fmt.Sprintf("\t%s %s `%s:\"%s\"`\n", goName(col.Name), typeName, TagPrefix, g.columnTag(ts, col, parentKey)))
+	}
+	for _, cm := range g.Children {
+		if strings.EqualFold(cm.Parent, ts.Name) {
+			buffer.WriteString(fmt.Sprintf("\t%s []*%s `%s:\"%s\"`\n", goName(cm.Child), goName(cm.Child), TagPrefix, cm.Child))
+		}
+	}
+	buffer.WriteString("}\n\n")
+}
+
+// Generate reads the schema of tables and writes gorb tagged structs to w.
+// All tables but the schema version and lock tables are generated if tables is empty.
+// Tables listed as Child in Children get the fk property on their parent key
+// and are referenced as child slices by their parent structs.
+func (g *StructGenerator) Generate(w io.Writer, tables ...string) error {
+	var e error
+	if len(tables) == 0 {
+		var names []string
+		names, e = g.Driver.ReadTableNames()
+		if e != nil {
+			return e
+		}
+		for _, name := range names {
+			if !strings.EqualFold(name, SchemaVersionTable) && !strings.EqualFold(name, SchemaLockTable) {
+				tables = append(tables, name)
+			}
+		}
+	}
+
+	var pkg string = g.Package
+	if len(pkg) == 0 {
+		pkg = "main"
+	}
+	var body bytes.Buffer
+	var needsTime, needsGorb, needsJson bool
+	for _, name := range tables {
+		var ts *TableSchema
+		ts, e = g.Driver.ReadTableSchema(name)
+		if e != nil {
+			return e
+		}
+		var parentKey *ForeignKeySchema
+		for _, cm := range g.Children {
+			if strings.EqualFold(cm.Child, name) {
+				parentKey, e = g.parentKey(cm, ts)
+				if e != nil {
+					return e
+				}
+				break
+			}
+		}
+		if parentKey == nil && ts.hasCompositeKey() {
+			return fmt.Errorf("Table %s: composite primary key is supported only for child tables, map the table in Children", ts.Name)
+		}
+		for _, col := range ts.Columns {
+			needsTime = needsTime || col.Type == DateTime
+			needsGorb = needsGorb || col.Type == Decimal
+			needsJson = needsJson || col.Type == Json
+		}
+		g.writeStruct(&body, ts, parentKey)
+	}
+
+	var src bytes.Buffer
+	src.WriteString("// Code generated by gorbgen. DO NOT EDIT.\n\n")
+	src.WriteString(fmt.Sprintf("package %s\n\n", pkg))
+	var imports []string
+	if needsJson {
+		imports = append(imports, "\"encoding/json\"")
+	}
+	if needsTime {
+		imports = append(imports, "\"time\"")
+	}
+	if needsGorb && pkg != "gorb" {
+		imports = append(imports, "\"github.com/skolu/gorb\"")
+	}
+	switch len(imports) {
+	case 0:
+	case 1:
+		src.WriteString(fmt.Sprintf("import %s\n\n", imports[0]))
+	default:
+		src.WriteString(fmt.Sprintf("import (\n\t%s\n)\n\n", strings.Join(imports, "\n\t")))
+	}
+	src.Write(body.Bytes())
+
+	formatted, e := format.Source(src.Bytes())
+	if e != nil {
+		return e
+	}
+	_, e = w.Write(formatted)
+	return e
+}
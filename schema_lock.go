@@ -0,0 +1,111 @@
+package gorb
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// SchemaLockTable holds the migration lock row of drivers without named locks
+const SchemaLockTable string = "gorb_schema_lock"
+
+// DefaultLockTimeout is used if SchemaUpgrader.LockTimeout is not set
+const DefaultLockTimeout time.Duration = time.Minute
+
+// ErrMigrationLockTimeout is returned, wrapped, when another process holds the migration lock
+var ErrMigrationLockTimeout = errors.New("Migration lock timeout")
+
+type (
+	// MigrationLocker is implemented by schema drivers that can serialize
+	// schema upgrades of concurrent processes. Lock waits at most timeout
+	// and returns an error wrapping ErrMigrationLockTimeout if the lock is held.
+	MigrationLocker interface {
+		Lock(timeout time.Duration) error
+		Unlock() error
+	}
+)
+
+// withLock runs fn holding the migration lock of the driver.
+// Nested calls share the lock, drivers without MigrationLocker run fn unlocked.
+func (su *SchemaUpgrader) withLock(fn func() error) (e error) {
+	locker, ok := su.SqlDmlDriver.(MigrationLocker)
+	if !ok || su.lockDepth > 0 {
+		su.lockDepth++
+		defer func() { su.lockDepth-- }()
+		return fn()
+	}
+
+	var timeout time.Duration = su.LockTimeout
+	if timeout <= 0 {
+		timeout = DefaultLockTimeout
+	}
+	e = locker.Lock(timeout)
+	if e != nil {
+		return e
+	}
+	su.lockDepth++
+	// the lock is released also if fn panics
+	defer func() {
+		su.lockDepth--
+		ue := locker.Unlock()
+		if e == nil {
+			e = ue
+		}
+	}()
+	return fn()
+}
+
+func newLockOwner() string {
+	var b []byte = make([]byte, 8)
+	rand.Read(b)
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+func ensureLockTable(db *sql.DB) error {
+	_, e := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id INTEGER NOT NULL PRIMARY KEY, owner VARCHAR(200) NOT NULL, acquired DATETIME NOT NULL)", SchemaLockTable))
+	return e
+}
+
+// acquireTableLock inserts the lock row, the primary key rejects concurrent owners.
+// The holder does not refresh the row, so a row is taken over as left by a crashed process
+// only if staleAge is set and the row is older. Otherwise it has to be removed manually:
+// DELETE FROM gorb_schema_lock
+func acquireTableLock(db *sql.DB, owner string, timeout time.Duration, staleAge time.Duration) error {
+	e := ensureLockTable(db)
+	if e != nil {
+		return e
+	}
+	var query string = fmt.Sprintf("INSERT INTO %s (id, owner, acquired) VALUES (1, ?, ?)", SchemaLockTable)
+	var staleQuery string = fmt.Sprintf("DELETE FROM %s WHERE id = 1 AND acquired < ?", SchemaLockTable)
+	var deadline time.Time = time.Now().Add(timeout)
+	for {
+		_, e = db.Exec(query, owner, timeToString(time.Now()))
+		if e == nil {
+			return nil
+		}
+		if staleAge > 0 {
+			res, de := db.Exec(staleQuery, timeToString(time.Now().Add(-staleAge)))
+			if de == nil {
+				if n, _ := res.RowsAffected(); n > 0 {
+					continue
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			var holder string
+			db.QueryRow(fmt.Sprintf("SELECT owner FROM %s WHERE id = 1", SchemaLockTable)).Scan(&holder)
+			return fmt.Errorf("%w: held by %s after %v (%v)", ErrMigrationLockTimeout, holder, timeout, e)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func releaseTableLock(db *sql.DB, owner string) error {
+	_, e := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = 1 AND owner = ?", SchemaLockTable), owner)
+	return e
+}
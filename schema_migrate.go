@@ -0,0 +1,115 @@
+package gorb
+
+import (
+	"fmt"
+	"sort"
+)
+
+type (
+	// MigrationFunc performs a migration step through the schema driver
+	MigrationFunc func(driver DbSchemaUpgrader) error
+
+	// Migration is a numbered step registered on SchemaUpgrader.
+	// Either Func or Script is executed.
+	Migration struct {
+		Version int32
+		Name    string
+		Script  []string
+		Func    MigrationFunc
+	}
+)
+
+func (su *SchemaUpgrader) addMigration(m *Migration) error {
+	if m.Version <= 0 {
+		return fmt.Errorf("Migration \"%s\": version should be positive", m.Name)
+	}
+	for _, mm := range su.migrations {
+		if mm.Version == m.Version {
+			return fmt.Errorf("Migration \"%s\": version %d is already registered by \"%s\"", m.Name, m.Version, mm.Name)
+		}
+	}
+	su.migrations = append(su.migrations, m)
+	sort.Slice(su.migrations, func(i, j int) bool {
+		return su.migrations[i].Version < su.migrations[j].Version
+	})
+	return nil
+}
+
+// RegisterMigration registers a Go function as migration step
+func (su *SchemaUpgrader) RegisterMigration(version int32, name string, fn MigrationFunc) error {
+	if fn == nil {
+		return fmt.Errorf("Migration \"%s\": function is nil", name)
+	}
+	return su.addMigration(&Migration{Version: version, Name: name, Func: fn})
+}
+
+// RegisterMigrationSql registers raw SQL statements as migration step
+func (su *SchemaUpgrader) RegisterMigrationSql(version int32, name string, script ...string) error {
+	if len(script) == 0 {
+		return fmt.Errorf("Migration \"%s\": script is empty", name)
+	}
+	return su.addMigration(&Migration{Version: version, Name: name, Script: script})
+}
+
+// PendingMigrations returns registered migrations newer than the database version
+func (su *SchemaUpgrader) PendingMigrations() ([]*Migration, error) {
+	version := su.SqlDmlDriver.GetVersion()
+	if version < 0 {
+		return nil, fmt.Errorf("Cannot read schema version")
+	}
+	var pending []*Migration = make([]*Migration, 0, len(su.migrations))
+	for _, m := range su.migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies pending migrations in version order holding the migration lock.
+// The version is recorded after each step, so a failed step is retried on the next run.
+func (su *SchemaUpgrader) Migrate() error {
+	return su.withLock(su.migrate)
+}
+
+func (su *SchemaUpgrader) migrate() error {
+	pending, e := su.PendingMigrations()
+	if e != nil {
+		return e
+	}
+	for _, m := range pending {
+		if m.Func != nil {
+			e = m.Func(su.SqlDmlDriver)
+		} else {
+			for _, query := range m.Script {
+				e = su.SqlDmlDriver.ExecQuery(query)
+				if e != nil {
+					break
+				}
+			}
+		}
+		if e != nil {
+			return fmt.Errorf("Migration %d \"%s\" failed: %v", m.Version, m.Name, e)
+		}
+		e = su.SqlDmlDriver.SetVersion(m.Version)
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// Upgrade brings the registered entities up to date with additive changes first,
+// then applies pending migrations, so that migration steps can rely on new columns.
+// Other processes wait for the migration lock until the whole upgrade is done.
+func (su *SchemaUpgrader) Upgrade(entities ...*Entity) error {
+	return su.withLock(func() error {
+		for _, ent := range entities {
+			e := su.UpgradeEntity(ent)
+			if e != nil {
+				return e
+			}
+		}
+		return su.Migrate()
+	})
+}
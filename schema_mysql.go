@@ -2,21 +2,56 @@ package gorb
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
+	"io"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type (
 	MySqlSchemaUpgrader struct {
-		Db         *sql.DB
+		Db *sql.DB
+		// Script receives statements of IsTestMode, they are discarded if Script is nil
+		Script io.Writer
+		// IsTestMode writes statements to Script instead of executing them.
+		// Deprecated: use SchemaUpgrader.PlanEntity to preview changes.
 		IsTestMode bool
+		// named locks belong to the session
+		lockConn *sql.Conn
 	}
 )
 
-func mySqlColumnType(columnType string) (dataType DataType, precision uint16) {
+// parsePrecision reads "(p)" or "(p,s)" of a column type
+func parsePrecision(columnType string) (precision uint16, scale uint16) {
+	re, e := regexp.Compile(".*\\((.+)\\).*")
+	if e == nil {
+		matches := re.FindStringSubmatch(columnType)
+		if len(matches) > 1 {
+			p, s := matches[1], ""
+			if idx := strings.Index(p, ","); idx >= 0 {
+				p, s = p[:idx], p[idx+1:]
+			}
+			var i int64
+			i, e = strconv.ParseInt(strings.TrimSpace(p), 10, 16)
+			if e == nil {
+				precision = uint16(i)
+			}
+			i, e = strconv.ParseInt(strings.TrimSpace(s), 10, 16)
+			if e == nil {
+				scale = uint16(i)
+			}
+		}
+	}
+	return
+}
+
+// mySqlColumnType maps a column_type of information_schema. Unsigned integers are reported by mySqlIsUnsigned.
+func mySqlColumnType(columnType string) (dataType DataType, precision uint16, scale uint16) {
 	columnType = strings.ToLower(columnType)
 	dataType = Unsupported
 	precision = 0
@@ -25,6 +60,9 @@ func mySqlColumnType(columnType string) (dataType DataType, precision uint16) {
 		dataType = String
 	}
 	if strings.HasPrefix(columnType, "smallint") {
+		dataType = Int16
+	}
+	if strings.HasPrefix(columnType, "mediumint") {
 		dataType = Int32
 	}
 	if strings.HasPrefix(columnType, "int") {
@@ -34,7 +72,11 @@ func mySqlColumnType(columnType string) (dataType DataType, precision uint16) {
 		dataType = Int64
 	}
 	if strings.HasPrefix(columnType, "tinyint") {
-		dataType = Bool
+		if strings.HasPrefix(columnType, "tinyint(1)") {
+			dataType = Bool
+		} else {
+			dataType = Int8
+		}
 	}
 	if strings.HasPrefix(columnType, "bit") {
 		dataType = Bool
@@ -43,7 +85,7 @@ func mySqlColumnType(columnType string) (dataType DataType, precision uint16) {
 		dataType = String
 	}
 	if strings.HasPrefix(columnType, "decimal") {
-		dataType = Float
+		dataType = Decimal
 	}
 	if strings.HasPrefix(columnType, "real") {
 		dataType = Float
@@ -52,7 +94,7 @@ func mySqlColumnType(columnType string) (dataType DataType, precision uint16) {
 		dataType = Float
 	}
 	if strings.HasPrefix(columnType, "numeric") {
-		dataType = Float
+		dataType = Decimal
 	}
 	if strings.HasPrefix(columnType, "date") {
 		dataType = DateTime
@@ -78,24 +120,27 @@ func mySqlColumnType(columnType string) (dataType DataType, precision uint16) {
 	if strings.HasPrefix(columnType, "longtext") {
 		dataType = String
 	}
+	if strings.HasPrefix(columnType, "json") {
+		dataType = Json
+	}
 
 	if dataType == String {
-		re, e := regexp.Compile(".*\\((.+)\\).*")
-		if e == nil {
-			matches := re.FindStringSubmatch(columnType)
-			if len(matches) > 1 {
-				var i int64
-				i, e = strconv.ParseInt(matches[1], 10, 16)
-				if e == nil {
-					precision = uint16(i)
-				}
-			}
+		precision, _ = parsePrecision(columnType)
+	}
+	if dataType == Decimal {
+		precision, scale = parsePrecision(columnType)
+		if precision == 0 {
+			precision = 10
 		}
 	}
 
 	return
 }
 
+func mySqlIsUnsigned(columnType string) bool {
+	return strings.Contains(strings.ToLower(columnType), "unsigned")
+}
+
 func mySqlColumnDefinition(col *ColumnSchema) string {
 	var typeDef []string = make([]string, 3)
 	typeDef[0] = col.Name
@@ -103,6 +148,10 @@ func mySqlColumnDefinition(col *ColumnSchema) string {
 	switch col.Type {
 	case Bool:
 		typeDef[1] = "Bit"
+	case Int8:
+		typeDef[1] = "Tinyint"
+	case Int16:
+		typeDef[1] = "Smallint"
 	case Int32:
 		typeDef[1] = "Integer"
 	case Int64:
@@ -119,21 +168,129 @@ func mySqlColumnDefinition(col *ColumnSchema) string {
 		typeDef[1] = "Timestamp"
 	case Blob:
 		typeDef[1] = "Blob"
-
+	case Decimal:
+		typeDef[1] = fmt.Sprintf("Decimal(%d,%d)", col.Precision, col.Scale)
+	case Json:
+		typeDef[1] = "Json"
+	}
+	if col.IsUnsigned && isIntegerType(col.Type) {
+		typeDef[1] += " Unsigned"
 	}
 	if col.IsNull {
 		typeDef[2] = "Null"
 	} else {
 		typeDef[2] = "Not Null"
 	}
+	if col.HasDefault {
+		typeDef = append(typeDef, "Default", col.defaultLiteral())
+	}
 	return strings.Join(typeDef, " ")
 }
 
+// forDB returns an upgrader with the settings of u connected to db
+func (u *MySqlSchemaUpgrader) forDB(db *sql.DB) DbSchemaUpgrader {
+	return &MySqlSchemaUpgrader{Db: db, Script: u.Script, IsTestMode: u.IsTestMode}
+}
+
+func (u *MySqlSchemaUpgrader) ExecQuery(query string) error {
+	if u.IsTestMode {
+		return writeStatement(u.Script, query)
+	}
+	if u.Db == nil {
+		return fmt.Errorf("MySqlShemaUpgrade: Connection has not been set")
+	}
+	_, e := u.Db.Exec(query)
+	return e
+}
+
 func (u *MySqlSchemaUpgrader) GetVersion() int32 {
-	return -1
+	if u.Db == nil {
+		return -1
+	}
+	names, e := u.ReadTableNames()
+	if e != nil {
+		return -1
+	}
+	version, e := readSchemaVersion(u.Db, names)
+	if e != nil {
+		return -1
+	}
+	return version
 }
+
 func (u *MySqlSchemaUpgrader) SetVersion(version int32) error {
-	return fmt.Errorf("Not implemented")
+	if u.IsTestMode {
+		return writeStatement(u.Script, schemaVersionQuery(version))
+	}
+	if u.Db == nil {
+		return fmt.Errorf("MySqlShemaUpgrade: Connection has not been set")
+	}
+	return writeSchemaVersion(u.Db, version)
+}
+
+// Lock takes the GET_LOCK named lock of the current database on a dedicated connection
+func (u *MySqlSchemaUpgrader) Lock(timeout time.Duration) error {
+	if u.IsTestMode {
+		return nil
+	}
+	if u.Db == nil {
+		return fmt.Errorf("MySqlShemaUpgrade: Connection has not been set")
+	}
+	if u.lockConn != nil {
+		return fmt.Errorf("MySqlShemaUpgrade: Migration lock is already held")
+	}
+	ctx := context.Background()
+	conn, e := u.Db.Conn(ctx)
+	if e != nil {
+		return e
+	}
+	var result sql.NullInt64
+	e = conn.QueryRowContext(ctx, "Select Get_Lock(Concat('gorb_migration.', Database()), ?)", int64(math.Ceil(timeout.Seconds()))).Scan(&result)
+	if e == nil && result.Int64 != 1 {
+		if result.Valid {
+			e = fmt.Errorf("%w: MySQL named lock is held by another session after %v", ErrMigrationLockTimeout, timeout)
+		} else {
+			e = fmt.Errorf("MySqlShemaUpgrade: Get_Lock failed")
+		}
+	}
+	if e != nil {
+		conn.Close()
+		return e
+	}
+	u.lockConn = conn
+	return nil
+}
+
+func (u *MySqlSchemaUpgrader) Unlock() error {
+	if u.lockConn == nil {
+		return nil
+	}
+	_, e := u.lockConn.ExecContext(context.Background(), "Do Release_Lock(Concat('gorb_migration.', Database()))")
+	// closing the session releases the lock anyway
+	u.lockConn.Close()
+	u.lockConn = nil
+	return e
+}
+
+func (u *MySqlSchemaUpgrader) ReadTableNames() ([]string, error) {
+	if u.Db == nil {
+		return nil, fmt.Errorf("MySqlShemaUpgrade: Connection has not been set")
+	}
+	rows, e := u.Db.Query("Show Tables")
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+	var names []string = make([]string, 0, 32)
+	for rows.Next() {
+		var name string
+		e = rows.Scan(&name)
+		if e != nil {
+			return nil, e
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
 }
 
 func (u *MySqlSchemaUpgrader) ReadTableSchema(tableName string) (*TableSchema, error) {
@@ -167,10 +324,15 @@ func (u *MySqlSchemaUpgrader) ReadTableSchema(tableName string) (*TableSchema, e
 		if len(columnKey) > 0 {
 			switch columnKey {
 			case "PRI":
-				tableSchema.PrimaryKey = cs
+				if tableSchema.PrimaryKey == nil {
+					tableSchema.PrimaryKey = cs
+				}
+				tableSchema.KeyColumns = append(tableSchema.KeyColumns, cs)
 			}
 		}
-		cs.Type, cs.Precision = mySqlColumnType(columnType)
+		cs.Type, cs.Precision, cs.Scale = mySqlColumnType(columnType)
+		cs.IsUnsigned = isIntegerType(cs.Type) && mySqlIsUnsigned(columnType)
+		cs.readDefault(columnDefault)
 
 		cs.IsNull, e = strconv.ParseBool(columnNull)
 		if e != nil {
@@ -181,104 +343,237 @@ func (u *MySqlSchemaUpgrader) ReadTableSchema(tableName string) (*TableSchema, e
 		tableSchema.Columns = append(tableSchema.Columns, cs)
 	}
 
-	rows, e = u.Db.Query(fmt.Sprintf("Show Index From %s Where Seq_In_Index=1;", tableName))
+	rows, e = u.Db.Query(fmt.Sprintf("Show Index From %s", tableName))
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+	//| Table | Non_unique | Key_name | Seq_in_index | Column_name | Collation | ... the rest depends on server version
+	var columns []string
+	columns, e = rows.Columns()
 	if e != nil {
 		return nil, e
 	}
-	//| Table | Non_unique | Key_name | Seq_in_index | Column_name | Collation | Cardinality | Sub_part | Packed | Null | Index_type | Comment | Index_comment |
+	var values []interface{} = make([]interface{}, len(columns))
+	var nonUniqueIdx, keyNameIdx, columnNameIdx int = -1, -1, -1
+	for i, name := range columns {
+		values[i] = new(sql.RawBytes)
+		switch strings.ToLower(name) {
+		case "non_unique":
+			nonUniqueIdx = i
+		case "key_name":
+			keyNameIdx = i
+		case "column_name":
+			columnNameIdx = i
+		}
+	}
+	if nonUniqueIdx < 0 || keyNameIdx < 0 || columnNameIdx < 0 {
+		return nil, fmt.Errorf("MySqlShemaUpgrade: Unexpected Show Index result")
+	}
+
 	tableSchema.Indice = make([]*IndexSchema, 0, 32)
+	var skipped map[string]bool = make(map[string]bool)
 	for rows.Next() {
-		var tabName, columnName string
-		var seqNo int
-		var skip *string
-		is := new(IndexSchema)
-		e = rows.Scan(&tabName, &is.IsUnique, &is.Name, &seqNo, &columnName, &skip, &skip, &skip, &skip, &skip, &skip, &skip, &skip)
+		e = rows.Scan(values...)
 		if e != nil {
 			return nil, e
 		}
+		keyName := string(*values[keyNameIdx].(*sql.RawBytes))
+		columnName := values[columnNameIdx].(*sql.RawBytes)
+		if keyName == "PRIMARY" || skipped[keyName] {
+			continue
+		}
 		var col *ColumnSchema
-		for _, col = range tableSchema.Columns {
-			if col.Name == columnName {
-				is.Column = col
+		if *columnName != nil {
+			col = tableSchema.ColumnByName(string(*columnName))
+		}
+		var is *IndexSchema
+		for _, idx := range tableSchema.Indice {
+			if idx.Name == keyName {
+				is = idx
 				break
 			}
 		}
-		if is.Column != nil {
-			if is.Column != tableSchema.PrimaryKey {
-				tableSchema.Indice = append(tableSchema.Indice, is)
+		if col == nil { // functional index
+			skipped[keyName] = true
+			if is != nil {
+				tableSchema.Indice = tableSchema.Indice[:len(tableSchema.Indice)-1]
 			}
+			continue
 		}
+		if is == nil {
+			is = new(IndexSchema)
+			is.Name = keyName
+			is.IsUnique = string(*values[nonUniqueIdx].(*sql.RawBytes)) == "0"
+			is.Columns = make([]*ColumnSchema, 0, 4)
+			tableSchema.Indice = append(tableSchema.Indice, is)
+		}
+		// rows come ordered by Seq_in_index
+		is.Columns = append(is.Columns, col)
+	}
+	e = rows.Err()
+	if e != nil {
+		return nil, e
+	}
+
+	tableSchema.ForeignKeys, e = u.readForeignKeys(tableSchema)
+	if e != nil {
+		return nil, e
 	}
 
 	return tableSchema, nil
 }
 
-func (u *MySqlSchemaUpgrader) CreateTable(schema *TableSchema) error {
-	var buffer bytes.Buffer
-	buffer.WriteString(fmt.Sprintf("Create Table %s (\n", schema.Name))
-	for _, col := range schema.Columns {
-		if col == schema.PrimaryKey {
-			if schema.PrimaryKey != schema.ForeignKey {
-				buffer.WriteString(fmt.Sprintf("\t%s %s,\n", col.Name, "SERIAL"))
-			} else {
-				buffer.WriteString(fmt.Sprintf("\t%s,\n", mySqlColumnDefinition(col)))
-			}
-		} else {
-			buffer.WriteString(fmt.Sprintf("\t%s,\n", mySqlColumnDefinition(col)))
-		}
+func (u *MySqlSchemaUpgrader) readForeignKeys(tableSchema *TableSchema) ([]*ForeignKeySchema, error) {
+	var query string = "Select k.CONSTRAINT_NAME, k.COLUMN_NAME, k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME, r.DELETE_RULE " +
+		"From information_schema.KEY_COLUMN_USAGE k Join information_schema.REFERENTIAL_CONSTRAINTS r " +
+		"On r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA And r.CONSTRAINT_NAME = k.CONSTRAINT_NAME And r.TABLE_NAME = k.TABLE_NAME " +
+		"Where k.TABLE_SCHEMA = Database() And k.TABLE_NAME = ? " +
+		"Order By k.CONSTRAINT_NAME, k.ORDINAL_POSITION"
+	rows, e := u.Db.Query(query, tableSchema.Name)
+	if e != nil {
+		return nil, e
 	}
+	defer rows.Close()
 
-	buffer.WriteString(fmt.Sprintf("\tPrimary Key(%s)\n);", schema.PrimaryKey.Name))
-
-	var query string = buffer.String()
-	if u.IsTestMode {
-		fmt.Println(query)
-	} else {
-		_, e := u.Db.Exec(query)
+	var fks []*ForeignKeySchema = make([]*ForeignKeySchema, 0, 4)
+	var fk *ForeignKeySchema
+	for rows.Next() {
+		var name, columnName, refTable, refColumn, deleteRule string
+		e = rows.Scan(&name, &columnName, &refTable, &refColumn, &deleteRule)
 		if e != nil {
-			return e
+			return nil, e
+		}
+		if fk == nil || fk.Name != name {
+			fk = new(ForeignKeySchema)
+			fk.Name = name
+			fk.RefTable = refTable
+			fk.OnDeleteCascade = strings.ToUpper(deleteRule) == "CASCADE"
+			fks = append(fks, fk)
+		}
+		var col *ColumnSchema = tableSchema.ColumnByName(columnName)
+		if col == nil {
+			col = &ColumnSchema{Name: columnName}
 		}
+		fk.Columns = append(fk.Columns, col)
+		fk.RefColumns = append(fk.RefColumns, refColumn)
+	}
+
+	return fks, rows.Err()
+}
+
+func mySqlIndexName(tableName string, index *IndexSchema) string {
+	if len(index.Name) == 0 {
+		index.Name = fmt.Sprintf("%s_%s_IDX", strings.ToUpper(tableName), strings.ToUpper(strings.Join(index.ColumnNames(), "_")))
 	}
+	return index.Name
+}
 
-	for _, idx := range schema.Indice {
-		buffer.Reset()
+func mySqlForeignKeyName(tableName string, fk *ForeignKeySchema) string {
+	if len(fk.Name) == 0 {
+		fk.Name = fmt.Sprintf("%s_%s_FK", strings.ToUpper(tableName), strings.ToUpper(strings.Join(fk.ColumnNames(), "_")))
+	}
+	return fk.Name
+}
 
-		if len(idx.Name) == 0 {
-			idx.Name = fmt.Sprintf("%s_%s_IDX", strings.ToUpper(schema.Name), strings.ToUpper(idx.Column.Name))
+func mySqlAddForeignKey(tableName string, fk *ForeignKeySchema) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Alter Table %s Add Constraint %s Foreign Key (%s) References %s (%s)", tableName, mySqlForeignKeyName(tableName, fk),
+		strings.Join(fk.ColumnNames(), ", "), fk.RefTable, strings.Join(fk.RefColumns, ", ")))
+	if fk.OnDeleteCascade {
+		buffer.WriteString(" On Delete Cascade")
+	}
+	return buffer.String()
+}
+
+func (u *MySqlSchemaUpgrader) ScriptOperation(op *SchemaOperation) ([]string, error) {
+	var buffer bytes.Buffer
+	switch op.Type {
+	case OperationCreateTable:
+		schema := op.Schema
+		buffer.WriteString(fmt.Sprintf("Create Table %s (\n", schema.Name))
+		for _, col := range schema.Columns {
+			if col == schema.PrimaryKey {
+				if schema.PrimaryKey != schema.ForeignKey && !schema.hasCompositeKey() && isIntegerType(col.Type) {
+					if schema.IsKeyReferenced {
+						// same type as the referencing columns, SERIAL would be unsigned
+						buffer.WriteString(fmt.Sprintf("\t%s Auto_Increment,\n", mySqlColumnDefinition(col)))
+					} else {
+						buffer.WriteString(fmt.Sprintf("\t%s %s,\n", col.Name, "SERIAL"))
+					}
+				} else {
+					buffer.WriteString(fmt.Sprintf("\t%s,\n", mySqlColumnDefinition(col)))
+				}
+			} else {
+				buffer.WriteString(fmt.Sprintf("\t%s,\n", mySqlColumnDefinition(col)))
+			}
+		}
+		buffer.WriteString(fmt.Sprintf("\tPrimary Key(%s)\n)", strings.Join(schema.KeyColumnNames(), ", ")))
+
+		var script []string = []string{buffer.String()}
+		for _, idx := range schema.Indice {
+			buffer.Reset()
+			buffer.WriteString("Create")
+			if idx.IsUnique {
+				buffer.WriteString(" Unique")
+			}
+			buffer.WriteString(" Index")
+			buffer.WriteString(fmt.Sprintf(" %s On %s (%s)", mySqlIndexName(schema.Name, idx), schema.Name, strings.Join(idx.ColumnNames(), ", ")))
+			script = append(script, buffer.String())
 		}
+		// constraints go after indexes so that MySQL does not create an implicit one
+		for _, fk := range schema.ForeignKeys {
+			script = append(script, mySqlAddForeignKey(schema.Name, fk))
+		}
+		return script, nil
+
+	case OperationAddColumn:
+		return []string{fmt.Sprintf("Alter Table %s Add Column %s", op.Table, mySqlColumnDefinition(op.Column))}, nil
 
-		buffer.WriteString("Create")
-		if idx.IsUnique {
+	case OperationAddIndex:
+		buffer.WriteString(fmt.Sprintf("Alter Table %s Add", op.Table))
+		if op.Index.IsUnique {
 			buffer.WriteString(" Unique")
 		}
-		buffer.WriteString(" Index")
+		buffer.WriteString(fmt.Sprintf(" Index %s (%s)", mySqlIndexName(op.Table, op.Index), strings.Join(op.Index.ColumnNames(), ", ")))
+		return []string{buffer.String()}, nil
 
-		buffer.WriteString(fmt.Sprintf(" %s On %s (%s);", idx.Name, schema.Name, idx.Column.Name))
+	case OperationModifyColumn:
+		return []string{fmt.Sprintf("Alter Table %s Modify Column %s", op.Table, mySqlColumnDefinition(op.Column))}, nil
 
-		var query string = buffer.String()
-		if u.IsTestMode {
-			fmt.Println(query)
-		} else {
-			_, e := u.Db.Exec(query)
-			if e != nil {
-				return e
-			}
-		}
-	}
+	case OperationDropIndex:
+		return []string{fmt.Sprintf("Alter Table %s Drop Index %s", op.Table, op.Index.Name)}, nil
 
-	return nil
-}
+	case OperationDropColumn:
+		return []string{fmt.Sprintf("Alter Table %s Drop Column %s", op.Table, op.Column.Name)}, nil
 
-func (u *MySqlSchemaUpgrader) AlterTableAddColumn(tableName string, column *ColumnSchema) error {
-	var buffer bytes.Buffer
+	case OperationDropTable:
+		return []string{fmt.Sprintf("Drop Table %s", op.Table)}, nil
 
-	buffer.WriteString(fmt.Sprintf("Alter Table %s Add Column %s;", tableName, mySqlColumnDefinition(column)))
+	case OperationAddForeignKey:
+		return []string{mySqlAddForeignKey(op.Table, op.ForeignKey)}, nil
 
-	var query string = buffer.String()
-	if u.IsTestMode {
-		fmt.Println(query)
-	} else {
-		_, e := u.Db.Exec(query)
+	case OperationRenameTable:
+		return []string{fmt.Sprintf("Rename Table %s To %s", op.OldName, op.Table)}, nil
+
+	case OperationRenameColumn:
+		// requires MySQL 8.0 or MariaDB 10.5
+		return []string{fmt.Sprintf("Alter Table %s Rename Column %s To %s", op.Table, op.OldColumn.Name, op.Column.Name)}, nil
+
+	case OperationDropForeignKey:
+		return []string{fmt.Sprintf("Alter Table %s Drop Foreign Key %s", op.Table, mySqlForeignKeyName(op.Table, op.ForeignKey))}, nil
+	}
+
+	return nil, fmt.Errorf("MySqlShemaUpgrade: Unsupported schema operation %s", op.Type)
+}
+
+func (u *MySqlSchemaUpgrader) execOperation(op *SchemaOperation) error {
+	script, e := u.ScriptOperation(op)
+	if e != nil {
+		return e
+	}
+	for _, query := range script {
+		e = u.ExecQuery(query)
 		if e != nil {
 			return e
 		}
@@ -286,24 +581,46 @@ func (u *MySqlSchemaUpgrader) AlterTableAddColumn(tableName string, column *Colu
 	return nil
 }
 
+func (u *MySqlSchemaUpgrader) CreateTable(schema *TableSchema) error {
+	return u.execOperation(&SchemaOperation{Type: OperationCreateTable, Table: schema.Name, Schema: schema})
+}
+
+func (u *MySqlSchemaUpgrader) AlterTableAddColumn(tableName string, column *ColumnSchema) error {
+	return u.execOperation(&SchemaOperation{Type: OperationAddColumn, Table: tableName, Column: column})
+}
+
 func (u *MySqlSchemaUpgrader) AlterTableAddIndex(tableName string, index *IndexSchema) error {
-	var buffer bytes.Buffer
+	return u.execOperation(&SchemaOperation{Type: OperationAddIndex, Table: tableName, Index: index})
+}
 
-	if len(index.Name) == 0 {
-		index.Name = fmt.Sprintf("%s_%s_IDX", strings.ToUpper(tableName), strings.ToUpper(index.Column.Name))
-	}
+func (u *MySqlSchemaUpgrader) AlterTableModifyColumn(tableName string, column *ColumnSchema) error {
+	return u.execOperation(&SchemaOperation{Type: OperationModifyColumn, Table: tableName, Column: column})
+}
 
-	buffer.WriteString(fmt.Sprintf("Alter Table %s Add Index %s (%s);", tableName, index.Name, index.Column.Name))
+func (u *MySqlSchemaUpgrader) AlterTableDropColumn(tableName string, columnName string) error {
+	return u.execOperation(&SchemaOperation{Type: OperationDropColumn, Table: tableName, Column: &ColumnSchema{Name: columnName}})
+}
 
-	var query string = buffer.String()
-	if u.IsTestMode {
-		fmt.Println(query)
-	} else {
-		_, e := u.Db.Exec(query)
-		if e != nil {
-			return e
-		}
-	}
+func (u *MySqlSchemaUpgrader) AlterTableDropIndex(tableName string, indexName string) error {
+	return u.execOperation(&SchemaOperation{Type: OperationDropIndex, Table: tableName, Index: &IndexSchema{Name: indexName}})
+}
 
-	return nil
+func (u *MySqlSchemaUpgrader) AlterTableAddForeignKey(tableName string, fk *ForeignKeySchema) error {
+	return u.execOperation(&SchemaOperation{Type: OperationAddForeignKey, Table: tableName, ForeignKey: fk})
+}
+
+func (u *MySqlSchemaUpgrader) AlterTableDropForeignKey(tableName string, fk *ForeignKeySchema) error {
+	return u.execOperation(&SchemaOperation{Type: OperationDropForeignKey, Table: tableName, ForeignKey: fk})
+}
+
+func (u *MySqlSchemaUpgrader) AlterTableRenameColumn(tableName string, oldName string, newName string) error {
+	return u.execOperation(&SchemaOperation{Type: OperationRenameColumn, Table: tableName, Column: &ColumnSchema{Name: newName}, OldColumn: &ColumnSchema{Name: oldName}})
+}
+
+func (u *MySqlSchemaUpgrader) RenameTable(oldName string, newName string) error {
+	return u.execOperation(&SchemaOperation{Type: OperationRenameTable, Table: newName, OldName: oldName})
+}
+
+func (u *MySqlSchemaUpgrader) DropTable(tableName string) error {
+	return u.execOperation(&SchemaOperation{Type: OperationDropTable, Table: tableName})
 }
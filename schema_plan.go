@@ -0,0 +1,669 @@
+package gorb
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type SchemaOperationType uint32
+
+const (
+	OperationCreateTable SchemaOperationType = iota
+	OperationAddColumn
+	OperationAddIndex
+	OperationModifyColumn
+	OperationDropIndex
+	OperationDropColumn
+	OperationDropTable
+	OperationAddForeignKey
+	OperationDropForeignKey
+	OperationRenameTable
+	OperationRenameColumn
+)
+
+type (
+	// SchemaOperation is a single planned change of the database schema.
+	// Sql holds the statements rendered by the schema driver.
+	// Schema is the table as declared by the entity, DbSchema as read from the database.
+	// Lossy operations are applied only if SchemaUpgrader.AllowDataLoss is set.
+	SchemaOperation struct {
+		Type       SchemaOperationType
+		Table      string
+		Schema     *TableSchema
+		DbSchema   *TableSchema
+		Column     *ColumnSchema
+		OldColumn  *ColumnSchema
+		Index      *IndexSchema
+		ForeignKey *ForeignKeySchema
+		// OldName is the previous table name of OperationRenameTable
+		OldName string
+		// Sql is empty if an earlier operation of the table applies the change,
+		// such as SQLite table rebuild applying all column and foreign key changes
+		Sql     []string
+		IsLossy bool
+		Warning string
+	}
+
+	// TablePlan lists planned operations for a table
+	TablePlan struct {
+		Table      string
+		IsNew      bool
+		Operations []*SchemaOperation
+	}
+
+	// SchemaPlan is the result of SchemaUpgrader.PlanEntity.
+	// It can be reviewed, written as SQL script or applied with SchemaUpgrader.ApplyPlan
+	SchemaPlan struct {
+		Tables []*TablePlan
+	}
+
+	// tableRebuilder is implemented by drivers that modify columns and foreign keys by recreating the table.
+	// The first of these operations renders one rebuild for all of them.
+	tableRebuilder interface {
+		scriptRebuild(dbSchema *TableSchema, ops []*SchemaOperation) ([]string, error)
+	}
+
+	// scriptExecutor is implemented by drivers that run the statements of an operation on one connection
+	scriptExecutor interface {
+		execScript(script []string) error
+	}
+)
+
+func (t SchemaOperationType) String() string {
+	switch t {
+	case OperationCreateTable:
+		return "CreateTable"
+	case OperationAddColumn:
+		return "AddColumn"
+	case OperationAddIndex:
+		return "AddIndex"
+	case OperationModifyColumn:
+		return "ModifyColumn"
+	case OperationDropIndex:
+		return "DropIndex"
+	case OperationDropColumn:
+		return "DropColumn"
+	case OperationDropTable:
+		return "DropTable"
+	case OperationAddForeignKey:
+		return "AddForeignKey"
+	case OperationDropForeignKey:
+		return "DropForeignKey"
+	case OperationRenameTable:
+		return "RenameTable"
+	case OperationRenameColumn:
+		return "RenameColumn"
+	}
+	return fmt.Sprintf("SchemaOperationType(%d)", uint32(t))
+}
+
+func (op *SchemaOperation) isRebuild() bool {
+	return op.Type == OperationModifyColumn || op.Type == OperationAddForeignKey || op.Type == OperationDropForeignKey
+}
+
+func (tp *TablePlan) addOperation(driver DbSchemaUpgrader, op *SchemaOperation) error {
+	var e error
+	op.Table = tp.Table
+	rebuilder, ok := driver.(tableRebuilder)
+	if !ok || !op.isRebuild() {
+		op.Sql, e = driver.ScriptOperation(op)
+		if e != nil {
+			return e
+		}
+		tp.Operations = append(tp.Operations, op)
+		return nil
+	}
+
+	var ops []*SchemaOperation = make([]*SchemaOperation, 0, len(tp.Operations)+1)
+	ops = append(append(ops, tp.Operations...), op)
+	var first *SchemaOperation = op
+	for _, prev := range tp.Operations {
+		if prev.isRebuild() {
+			first = prev
+			break
+		}
+	}
+	op.Sql = nil
+	first.Sql, e = rebuilder.scriptRebuild(first.DbSchema, ops)
+	if e != nil {
+		return e
+	}
+	tp.Operations = append(tp.Operations, op)
+	return nil
+}
+
+// IsEmpty reports whether the plan has no operations
+func (p *SchemaPlan) IsEmpty() bool {
+	for _, tp := range p.Tables {
+		if len(tp.Operations) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Operations returns all planned operations in execution order
+func (p *SchemaPlan) Operations() []*SchemaOperation {
+	var ops []*SchemaOperation = make([]*SchemaOperation, 0, 16)
+	for _, tp := range p.Tables {
+		ops = append(ops, tp.Operations...)
+	}
+	return ops
+}
+
+// WriteScript writes the planned statements as SQL script
+func (p *SchemaPlan) WriteScript(w io.Writer) error {
+	for _, tp := range p.Tables {
+		if len(tp.Operations) == 0 {
+			continue
+		}
+		_, e := fmt.Fprintf(w, "-- %s\n", tp.Table)
+		if e != nil {
+			return e
+		}
+		for _, op := range tp.Operations {
+			for _, query := range op.Sql {
+				e = writeStatement(w, query)
+				if e != nil {
+					return e
+				}
+			}
+		}
+		_, e = fmt.Fprintln(w)
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// writeStatement writes a statement of the script to w, nothing is written if w is nil
+func writeStatement(w io.Writer, query string) error {
+	if w == nil {
+		return nil
+	}
+	_, e := fmt.Fprintf(w, "%s;\n", query)
+	return e
+}
+
+func isIntegerType(dt DataType) bool {
+	return dt == Int8 || dt == Int16 || dt == Int32 || dt == Int64
+}
+
+func integerBits(dt DataType) int {
+	switch dt {
+	case Int8:
+		return 8
+	case Int16:
+		return 16
+	case Int32:
+		return 32
+	}
+	return 64
+}
+
+func integerTypeName(col *ColumnSchema) string {
+	if col.IsUnsigned {
+		return "Unsigned " + col.Type.String()
+	}
+	return col.Type.String()
+}
+
+// integerFits reports whether every value of the db column can be stored in the class column
+func integerFits(classColumn, dbColumn *ColumnSchema) bool {
+	if classColumn.IsUnsigned == dbColumn.IsUnsigned {
+		return integerBits(classColumn.Type) >= integerBits(dbColumn.Type)
+	}
+	// a wider column keeps all values, rows of unsigned fields hold no negative values
+	return integerBits(classColumn.Type) > integerBits(dbColumn.Type)
+}
+
+// compareColumn checks whether the database column has to be modified to match the class column.
+// lossy is set when the conversion may lose data or fail on existing rows.
+func compareColumn(classColumn, dbColumn *ColumnSchema) (differs bool, lossy bool, warning string) {
+	if dbColumn.Type == Unsupported {
+		// unknown database type is left alone
+		return false, false, ""
+	}
+	var warnings []string = make([]string, 0, 2)
+
+	if classColumn.Type == Float && dbColumn.Type == Decimal {
+		// decimal columns were mapped to float fields before Decimal was supported
+	} else if isIntegerType(classColumn.Type) && isIntegerType(dbColumn.Type) {
+		if classColumn.Type != dbColumn.Type || classColumn.IsUnsigned != dbColumn.IsUnsigned {
+			differs = true
+			if !integerFits(classColumn, dbColumn) {
+				lossy = true
+				warnings = append(warnings, fmt.Sprintf("type %s to %s", integerTypeName(dbColumn), integerTypeName(classColumn)))
+			}
+		}
+	} else if classColumn.Type != dbColumn.Type {
+		differs = true
+		switch {
+		case dbColumn.Type == Bool && isIntegerType(classColumn.Type):
+		case isIntegerType(dbColumn.Type) && integerBits(dbColumn.Type) <= 32 && classColumn.Type == Float:
+		case classColumn.Type == String && classColumn.Precision == 0 && dbColumn.Type != Blob:
+		default:
+			lossy = true
+			warnings = append(warnings, fmt.Sprintf("type %s to %s", dbColumn.Type, classColumn.Type))
+		}
+	} else if classColumn.Type == String && classColumn.Precision != dbColumn.Precision {
+		differs = true
+		if classColumn.Precision > 0 && (dbColumn.Precision == 0 || classColumn.Precision < dbColumn.Precision) {
+			lossy = true
+			warnings = append(warnings, fmt.Sprintf("length %d to %d", dbColumn.Precision, classColumn.Precision))
+		}
+	} else if classColumn.Type == Decimal && (classColumn.Precision != dbColumn.Precision || classColumn.Scale != dbColumn.Scale) {
+		differs = true
+		if classColumn.Scale < dbColumn.Scale || classColumn.Precision-classColumn.Scale < dbColumn.Precision-dbColumn.Scale {
+			lossy = true
+			warnings = append(warnings, fmt.Sprintf("decimal(%d,%d) to decimal(%d,%d)", dbColumn.Precision, dbColumn.Scale, classColumn.Precision, classColumn.Scale))
+		}
+	}
+
+	if classColumn.HasDefault != dbColumn.HasDefault || classColumn.Default != dbColumn.Default {
+		differs = true
+	}
+
+	if classColumn.IsNull != dbColumn.IsNull {
+		differs = true
+		if dbColumn.IsNull {
+			lossy = true
+			warnings = append(warnings, "NULL to NOT NULL")
+		}
+	}
+
+	if lossy {
+		warning = fmt.Sprintf("Column %s: %s may lose data", classColumn.Name, strings.Join(warnings, ", "))
+	}
+	return
+}
+
+// planTable compares a table with the database, tableNames are read by ReadTableNames.
+// Only absent tables are created, other read errors are returned.
+func (su *SchemaUpgrader) planTable(classSchema *TableSchema, tableNames []string) (*TablePlan, error) {
+	var tp *TablePlan = new(TablePlan)
+	tp.Table = classSchema.Name
+	tp.Operations = make([]*SchemaOperation, 0, 4)
+
+	var tableName string = classSchema.Name
+	if !containsTable(tableNames, tableName) {
+		tableName = ""
+		for _, name := range classSchema.PreviousNames {
+			if containsTable(tableNames, name) {
+				tableName = name
+				break
+			}
+		}
+	}
+	if len(tableName) == 0 { // create
+		tp.IsNew = true
+		e := tp.addOperation(su.SqlDmlDriver, &SchemaOperation{Type: OperationCreateTable, Schema: classSchema})
+		return tp, e
+	}
+	dbSchema, e := su.SqlDmlDriver.ReadTableSchema(tableName)
+	if e != nil {
+		return nil, fmt.Errorf("Table %s: %v", tableName, e)
+	}
+	if tableName != classSchema.Name {
+		e = tp.addOperation(su.SqlDmlDriver, &SchemaOperation{Type: OperationRenameTable, Schema: classSchema, DbSchema: dbSchema, OldName: tableName})
+		if e != nil {
+			return nil, e
+		}
+	}
+	// renames are applied to the copy, the operations below see the renamed schema
+	dbSchema = dbSchema.clone()
+	dbSchema.Name = classSchema.Name
+
+	for _, fsc := range classSchema.Columns {
+		if dbSchema.ColumnByName(fsc.Name) != nil {
+			continue
+		}
+		for _, name := range fsc.PreviousNames {
+			fsdb := dbSchema.ColumnByName(name)
+			if fsdb != nil {
+				oldColumn := *fsdb
+				e = tp.addOperation(su.SqlDmlDriver, &SchemaOperation{Type: OperationRenameColumn, Schema: classSchema, DbSchema: dbSchema, Column: fsc, OldColumn: &oldColumn})
+				if e != nil {
+					return nil, e
+				}
+				fsdb.Name = fsc.Name
+				break
+			}
+		}
+	}
+
+	for _, fsc := range classSchema.Columns {
+		found := false
+		for _, fsdb := range dbSchema.Columns {
+			if fsc.Name == fsdb.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			e = tp.addOperation(su.SqlDmlDriver, &SchemaOperation{Type: OperationAddColumn, Schema: classSchema, DbSchema: dbSchema, Column: fsc})
+			if e != nil {
+				return nil, e
+			}
+		}
+	}
+
+	for _, fsc := range classSchema.Columns {
+		if fsc == classSchema.PrimaryKey {
+			// serial keys are read back with database specific types
+			continue
+		}
+		for _, fsdb := range dbSchema.Columns {
+			if fsc.Name == fsdb.Name {
+				differs, lossy, warning := compareColumn(fsc, fsdb)
+				if differs {
+					op := &SchemaOperation{Type: OperationModifyColumn, Schema: classSchema, DbSchema: dbSchema, Column: fsc, OldColumn: fsdb, IsLossy: lossy, Warning: warning}
+					e = tp.addOperation(su.SqlDmlDriver, op)
+					if e != nil {
+						return nil, e
+					}
+				}
+				break
+			}
+		}
+	}
+
+	// foreign keys follow column modifications, so that a table rebuild precedes added indexes
+	for _, fksc := range classSchema.ForeignKeys {
+		fkdb := dbSchema.ForeignKeyLike(fksc)
+		if fkdb != nil && !fkdb.sameReference(fksc) {
+			// reference or delete rule changed: recreate
+			e = tp.addOperation(su.SqlDmlDriver, &SchemaOperation{Type: OperationDropForeignKey, Schema: classSchema, DbSchema: dbSchema, ForeignKey: fkdb})
+			if e != nil {
+				return nil, e
+			}
+			fkdb = nil
+		}
+		if fkdb == nil {
+			e = tp.addOperation(su.SqlDmlDriver, &SchemaOperation{Type: OperationAddForeignKey, Schema: classSchema, DbSchema: dbSchema, ForeignKey: fksc})
+			if e != nil {
+				return nil, e
+			}
+		}
+	}
+
+	if su.DropUnmapped && su.ForeignKeys {
+		for _, fkdb := range dbSchema.ForeignKeys {
+			if classSchema.ForeignKeyLike(fkdb) == nil {
+				op := &SchemaOperation{Type: OperationDropForeignKey, Schema: classSchema, DbSchema: dbSchema, ForeignKey: fkdb, IsLossy: true,
+					Warning: fmt.Sprintf("Foreign key on %s is not declared", strings.Join(fkdb.ColumnNames(), ", "))}
+				e = tp.addOperation(su.SqlDmlDriver, op)
+				if e != nil {
+					return nil, e
+				}
+			}
+		}
+	}
+
+	for _, isc := range classSchema.Indice {
+		isdb := dbSchema.IndexLike(isc)
+		if isdb != nil && isdb.IsUnique != isc.IsUnique {
+			// uniqueness changed: recreate
+			e = tp.addOperation(su.SqlDmlDriver, &SchemaOperation{Type: OperationDropIndex, Schema: classSchema, DbSchema: dbSchema, Index: isdb})
+			if e != nil {
+				return nil, e
+			}
+			isdb = nil
+		}
+		if isdb == nil {
+			e = tp.addOperation(su.SqlDmlDriver, &SchemaOperation{Type: OperationAddIndex, Schema: classSchema, DbSchema: dbSchema, Index: isc})
+			if e != nil {
+				return nil, e
+			}
+		}
+	}
+
+	if su.DropUnmapped {
+		e = su.planDrops(tp, classSchema, dbSchema)
+		if e != nil {
+			return nil, e
+		}
+	}
+
+	return tp, nil
+}
+
+func (su *SchemaUpgrader) planDrops(tp *TablePlan, classSchema, dbSchema *TableSchema) error {
+	var e error
+	for _, isdb := range dbSchema.Indice {
+		if classSchema.IndexLike(isdb) == nil {
+			op := &SchemaOperation{Type: OperationDropIndex, Schema: classSchema, DbSchema: dbSchema, Index: isdb, IsLossy: true,
+				Warning: fmt.Sprintf("Index %s is not declared", isdb.Name)}
+			e = tp.addOperation(su.SqlDmlDriver, op)
+			if e != nil {
+				return e
+			}
+		}
+	}
+
+	for _, fsdb := range dbSchema.Columns {
+		found := false
+		for _, fsc := range classSchema.Columns {
+			if fsc.Name == fsdb.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			op := &SchemaOperation{Type: OperationDropColumn, Schema: classSchema, DbSchema: dbSchema, Column: fsdb, IsLossy: true,
+				Warning: fmt.Sprintf("Column %s is not declared, its data will be lost", fsdb.Name)}
+			e = tp.addOperation(su.SqlDmlDriver, op)
+			if e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// PlanOrphanedTables reports database tables with one of the name prefixes that are not mapped
+// by any entity registered in mgr, such as child tables removed from entity classes.
+// Tables of other applications sharing the database are left alone by passing the prefixes
+// of gorb tables only. The returned plan drops them, so it can be applied only with AllowDataLoss set.
+func (su *SchemaUpgrader) PlanOrphanedTables(mgr *GorbManager, prefixes ...string) (*SchemaPlan, error) {
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("Table name prefix is required")
+	}
+	for _, prefix := range prefixes {
+		if len(prefix) == 0 {
+			return nil, fmt.Errorf("Table name prefix cannot be empty")
+		}
+	}
+	names, e := su.SqlDmlDriver.ReadTableNames()
+	if e != nil {
+		return nil, e
+	}
+
+	var mapped map[string]bool = make(map[string]bool, 32)
+	mapped[strings.ToLower(SchemaVersionTable)] = true
+	mapped[strings.ToLower(SchemaLockTable)] = true
+	for _, ent := range mgr.Entities {
+		var tables []*Table = []*Table{&ent.Table}
+		for _, child := range ent.FlattenChildren() {
+			tables = append(tables, &child.Table)
+		}
+		for _, t := range tables {
+			mapped[strings.ToLower(t.TableName)] = true
+			// pending renames
+			for _, name := range t.PreviousNames {
+				mapped[strings.ToLower(name)] = true
+			}
+		}
+		for _, rel := range ent.Relations {
+			mapped[strings.ToLower(rel.TableName)] = true
+		}
+	}
+
+	var plan *SchemaPlan = new(SchemaPlan)
+	plan.Tables = make([]*TablePlan, 0, 4)
+	for _, name := range names {
+		if mapped[strings.ToLower(name)] || !hasTablePrefix(name, prefixes) {
+			continue
+		}
+		var tp *TablePlan = &TablePlan{Table: name, Operations: make([]*SchemaOperation, 0, 1)}
+		op := &SchemaOperation{Type: OperationDropTable, IsLossy: true,
+			Warning: fmt.Sprintf("Table %s is not mapped by any entity", name)}
+		e = tp.addOperation(su.SqlDmlDriver, op)
+		if e != nil {
+			return nil, e
+		}
+		plan.Tables = append(plan.Tables, tp)
+	}
+
+	return plan, nil
+}
+
+func hasTablePrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(strings.ToLower(name), strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortTablesByDependency orders tables so that tables referenced by foreign keys come first.
+// Otherwise the order is kept, cycles are broken at the first table of the cycle.
+func sortTablesByDependency(tables []*TableSchema) []*TableSchema {
+	var byName map[string]*TableSchema = make(map[string]*TableSchema, len(tables))
+	for _, ts := range tables {
+		byName[strings.ToLower(ts.Name)] = ts
+	}
+
+	var sorted []*TableSchema = make([]*TableSchema, 0, len(tables))
+	var visited map[*TableSchema]bool = make(map[*TableSchema]bool, len(tables))
+	var visit func(ts *TableSchema)
+	visit = func(ts *TableSchema) {
+		visited[ts] = true
+		for _, fk := range ts.ForeignKeys {
+			ref := byName[strings.ToLower(fk.RefTable)]
+			if ref != nil && !visited[ref] {
+				visit(ref)
+			}
+		}
+		sorted = append(sorted, ts)
+	}
+	for _, ts := range tables {
+		if !visited[ts] {
+			visit(ts)
+		}
+	}
+	return sorted
+}
+
+// WriteDDL writes CREATE statements for all entities registered in mgr, their child tables and join tables
+// as rendered by SqlDmlDriver. Entities are ordered by table name, referenced tables come first.
+// The database is not accessed, so a driver without connection can be used.
+func (su *SchemaUpgrader) WriteDDL(w io.Writer, mgr *GorbManager) error {
+	var entities []*Entity = make([]*Entity, 0, len(mgr.Entities))
+	for _, ent := range mgr.Entities {
+		entities = append(entities, ent)
+	}
+	sort.Slice(entities, func(i, j int) bool {
+		return entities[i].TableName < entities[j].TableName
+	})
+
+	var tables []*TableSchema = make([]*TableSchema, 0, len(entities)*2)
+	var written map[string]bool = make(map[string]bool, len(entities)*2)
+	for _, ent := range entities {
+		for _, ts := range su.getEntitySchemas(ent) {
+			// join tables may be declared on both related entities
+			if !written[strings.ToLower(ts.Name)] {
+				written[strings.ToLower(ts.Name)] = true
+				tables = append(tables, ts)
+			}
+		}
+	}
+
+	var plan *SchemaPlan = new(SchemaPlan)
+	plan.Tables = make([]*TablePlan, 0, len(tables))
+	for _, ts := range sortTablesByDependency(tables) {
+		var tp *TablePlan = &TablePlan{Table: ts.Name, IsNew: true, Operations: make([]*SchemaOperation, 0, 1)}
+		e := tp.addOperation(su.SqlDmlDriver, &SchemaOperation{Type: OperationCreateTable, Schema: ts})
+		if e != nil {
+			return e
+		}
+		plan.Tables = append(plan.Tables, tp)
+	}
+
+	return plan.WriteScript(w)
+}
+
+// PlanEntity compares the entity, its child tables and join tables with the database schema
+// and returns the operations UpgradeEntity would perform. Nothing is executed.
+func (su *SchemaUpgrader) PlanEntity(ent *Entity) (*SchemaPlan, error) {
+	tables := su.getEntitySchemas(ent)
+	names, e := su.SqlDmlDriver.ReadTableNames()
+	if e != nil {
+		return nil, e
+	}
+
+	var plan *SchemaPlan = new(SchemaPlan)
+	plan.Tables = make([]*TablePlan, 0, len(tables))
+	for _, classSchema := range tables {
+		tp, e := su.planTable(classSchema, names)
+		if e != nil {
+			return nil, e
+		}
+		plan.Tables = append(plan.Tables, tp)
+	}
+
+	return plan, nil
+}
+
+// LossyOperations returns operations that may lose data
+func (p *SchemaPlan) LossyOperations() []*SchemaOperation {
+	var ops []*SchemaOperation = make([]*SchemaOperation, 0, 4)
+	for _, op := range p.Operations() {
+		if op.IsLossy {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// ApplyPlan executes the statements of a plan in order.
+// A plan with lossy operations is refused unless AllowDataLoss is set.
+func (su *SchemaUpgrader) ApplyPlan(plan *SchemaPlan) error {
+	if !su.AllowDataLoss {
+		lossy := plan.LossyOperations()
+		if len(lossy) > 0 {
+			var warnings []string = make([]string, len(lossy))
+			for i, op := range lossy {
+				warnings[i] = fmt.Sprintf("%s %s: %s", op.Type, op.Table, op.Warning)
+			}
+			return fmt.Errorf("Schema upgrade may lose data, set AllowDataLoss to proceed:\n%s", strings.Join(warnings, "\n"))
+		}
+	}
+	for _, op := range plan.Operations() {
+		e := execScript(su.SqlDmlDriver, op.Sql)
+		if e != nil {
+			return fmt.Errorf("%s %s: %v", op.Type, op.Table, e)
+		}
+	}
+	return nil
+}
+
+func execScript(driver DbSchemaUpgrader, script []string) error {
+	if len(script) == 0 {
+		return nil
+	}
+	if executor, ok := driver.(scriptExecutor); ok {
+		return executor.execScript(script)
+	}
+	for _, query := range script {
+		e := driver.ExecQuery(query)
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
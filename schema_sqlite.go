@@ -0,0 +1,728 @@
+package gorb
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type (
+	// SqliteSchemaUpgrader implements DbSchemaUpgrader for SQLite databases.
+	// Column types are declared with the names below so that the gorb DataType
+	// can be recovered from PRAGMA table_info; SQLite itself only keeps the affinity.
+	SqliteSchemaUpgrader struct {
+		Db *sql.DB
+		// StaleLockAge is the age of a migration lock row that is taken over as left by a crashed process.
+		// It has to exceed the longest schema upgrade, lock rows are not taken over if it is not set
+		StaleLockAge time.Duration
+		// Script receives statements of IsTestMode, they are discarded if Script is nil
+		Script io.Writer
+		// IsTestMode writes statements to Script instead of executing them.
+		// Deprecated: use SchemaUpgrader.PlanEntity to preview changes.
+		IsTestMode bool
+		lockOwner  string
+	}
+)
+
+func sqliteColumnType(columnType string) (dataType DataType, precision uint16, scale uint16) {
+	columnType = strings.ToLower(strings.TrimSpace(columnType))
+	dataType = Unsupported
+	precision = 0
+
+	switch {
+	case strings.HasPrefix(columnType, "decimal_text"):
+		// TEXT affinity keeps decimals exact
+		dataType = Decimal
+	case strings.HasPrefix(columnType, "json"):
+		dataType = Json
+	case strings.HasPrefix(columnType, "boolean"), strings.HasPrefix(columnType, "bit"):
+		dataType = Bool
+	case strings.HasPrefix(columnType, "tinyint"):
+		dataType = Int8
+	case strings.HasPrefix(columnType, "smallint"):
+		dataType = Int16
+	case strings.HasPrefix(columnType, "bigint"), columnType == "integer":
+		// INTEGER is declared only for serial primary keys, whatever the field type,
+		// since only INTEGER PRIMARY KEY aliases the 64 bit rowid
+		dataType = Int64
+	case strings.HasPrefix(columnType, "int"), strings.HasPrefix(columnType, "mediumint"):
+		dataType = Int32
+	case strings.HasPrefix(columnType, "real"), strings.HasPrefix(columnType, "double"), strings.HasPrefix(columnType, "float"), strings.HasPrefix(columnType, "numeric"), strings.HasPrefix(columnType, "decimal"):
+		dataType = Float
+	case strings.HasPrefix(columnType, "datetime"), strings.HasPrefix(columnType, "timestamp"), strings.HasPrefix(columnType, "date"):
+		dataType = DateTime
+	case strings.HasPrefix(columnType, "varchar"), strings.HasPrefix(columnType, "char"), strings.HasPrefix(columnType, "nvarchar"), strings.HasPrefix(columnType, "text"), strings.HasPrefix(columnType, "clob"):
+		dataType = String
+	case strings.HasPrefix(columnType, "blob"), columnType == "":
+		dataType = Blob
+	case strings.Contains(columnType, "int"):
+		dataType = Int64
+	case strings.Contains(columnType, "char"), strings.Contains(columnType, "text"):
+		dataType = String
+	}
+
+	if dataType == String {
+		precision, _ = parsePrecision(columnType)
+	}
+	if dataType == Decimal {
+		precision, scale = parsePrecision(columnType)
+	}
+
+	return
+}
+
+func sqliteColumnDefinition(col *ColumnSchema) string {
+	var typeDef []string = make([]string, 3)
+	typeDef[0] = col.Name
+
+	switch col.Type {
+	case Bool:
+		typeDef[1] = "BOOLEAN"
+	case Int8:
+		typeDef[1] = "TINYINT"
+	case Int16:
+		typeDef[1] = "SMALLINT"
+	case Int32:
+		typeDef[1] = "INT"
+	case Int64:
+		typeDef[1] = "BIGINT"
+	case Float:
+		typeDef[1] = "DOUBLE"
+	case String:
+		if col.Precision > 0 {
+			typeDef[1] = fmt.Sprintf("VARCHAR(%d)", col.Precision)
+		} else {
+			typeDef[1] = "TEXT"
+		}
+	case DateTime:
+		typeDef[1] = "DATETIME"
+	case Blob:
+		typeDef[1] = "BLOB"
+	case Decimal:
+		typeDef[1] = fmt.Sprintf("DECIMAL_TEXT(%d,%d)", col.Precision, col.Scale)
+	case Json:
+		typeDef[1] = "JSON_TEXT"
+	}
+	if col.IsUnsigned && isIntegerType(col.Type) {
+		// the type name is kept only to read the column back as unsigned
+		typeDef[1] += " UNSIGNED"
+	}
+	if len(col.declaredType) > 0 {
+		// unmodified column of a rebuilt table
+		typeDef[1] = col.declaredType
+	}
+	if col.IsNull {
+		typeDef[2] = "NULL"
+	} else {
+		typeDef[2] = "NOT NULL"
+	}
+	if col.HasDefault {
+		typeDef = append(typeDef, "DEFAULT", col.defaultLiteral())
+	}
+	return strings.Join(typeDef, " ")
+}
+
+// forDB returns an upgrader with the settings of u connected to db
+func (u *SqliteSchemaUpgrader) forDB(db *sql.DB) DbSchemaUpgrader {
+	return &SqliteSchemaUpgrader{Db: db, StaleLockAge: u.StaleLockAge, Script: u.Script, IsTestMode: u.IsTestMode}
+}
+
+func (u *SqliteSchemaUpgrader) ExecQuery(query string) error {
+	if u.IsTestMode {
+		return writeStatement(u.Script, query)
+	}
+	if u.Db == nil {
+		return fmt.Errorf("SqliteSchemaUpgrader: Connection has not been set")
+	}
+	_, e := u.Db.Exec(query)
+	return e
+}
+
+func (u *SqliteSchemaUpgrader) GetVersion() int32 {
+	if u.Db == nil {
+		return -1
+	}
+	names, e := u.ReadTableNames()
+	if e != nil {
+		return -1
+	}
+	version, e := readSchemaVersion(u.Db, names)
+	if e != nil {
+		return -1
+	}
+	return version
+}
+
+func (u *SqliteSchemaUpgrader) SetVersion(version int32) error {
+	if u.IsTestMode {
+		return writeStatement(u.Script, schemaVersionQuery(version))
+	}
+	if u.Db == nil {
+		return fmt.Errorf("SqliteSchemaUpgrader: Connection has not been set")
+	}
+	return writeSchemaVersion(u.Db, version)
+}
+
+// Lock inserts the lock row into SchemaLockTable
+func (u *SqliteSchemaUpgrader) Lock(timeout time.Duration) error {
+	if u.IsTestMode {
+		return nil
+	}
+	if u.Db == nil {
+		return fmt.Errorf("SqliteSchemaUpgrader: Connection has not been set")
+	}
+	if len(u.lockOwner) > 0 {
+		return fmt.Errorf("SqliteSchemaUpgrader: Migration lock is already held")
+	}
+	owner := newLockOwner()
+	e := acquireTableLock(u.Db, owner, timeout, u.StaleLockAge)
+	if e != nil {
+		return e
+	}
+	u.lockOwner = owner
+	return nil
+}
+
+func (u *SqliteSchemaUpgrader) Unlock() error {
+	if len(u.lockOwner) == 0 {
+		return nil
+	}
+	e := releaseTableLock(u.Db, u.lockOwner)
+	u.lockOwner = ""
+	return e
+}
+
+func (u *SqliteSchemaUpgrader) ReadTableNames() ([]string, error) {
+	if u.Db == nil {
+		return nil, fmt.Errorf("SqliteSchemaUpgrader: Connection has not been set")
+	}
+	rows, e := u.Db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+	var names []string = make([]string, 0, 32)
+	for rows.Next() {
+		var name string
+		e = rows.Scan(&name)
+		if e != nil {
+			return nil, e
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (u *SqliteSchemaUpgrader) ReadTableSchema(tableName string) (*TableSchema, error) {
+	if u.Db == nil {
+		return nil, fmt.Errorf("SqliteSchemaUpgrader: Connection has not been set")
+	}
+
+	var rows *sql.Rows
+	var e error
+
+	//| cid | name | type | notnull | dflt_value | pk |
+	rows, e = u.Db.Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
+	if e != nil {
+		return nil, e
+	}
+	var tableSchema *TableSchema = new(TableSchema)
+	tableSchema.Name = tableName
+
+	tableSchema.Columns = make([]*ColumnSchema, 0, 32)
+	var keyColumns map[int]*ColumnSchema = make(map[int]*ColumnSchema)
+	for rows.Next() {
+		cs := new(ColumnSchema)
+		var cid, notNull, pk int
+		var columnType string
+		var columnDefault *string
+
+		e = rows.Scan(&cid, &cs.Name, &columnType, &notNull, &columnDefault, &pk)
+		if e != nil {
+			rows.Close()
+			return nil, e
+		}
+		if pk > 0 {
+			keyColumns[pk] = cs
+		}
+		cs.Type, cs.Precision, cs.Scale = sqliteColumnType(columnType)
+		cs.declaredType = columnType
+		cs.IsUnsigned = isIntegerType(cs.Type) && strings.Contains(strings.ToLower(columnType), "unsigned")
+		cs.readDefault(columnDefault)
+		cs.IsNull = notNull == 0 && pk == 0
+		tableSchema.Columns = append(tableSchema.Columns, cs)
+	}
+	rows.Close()
+	if len(tableSchema.Columns) == 0 {
+		return nil, fmt.Errorf("Table %s does not exist", tableName)
+	}
+	// pk is the position of the column in the primary key
+	for i := 1; i <= len(keyColumns); i++ {
+		tableSchema.KeyColumns = append(tableSchema.KeyColumns, keyColumns[i])
+	}
+	if len(tableSchema.KeyColumns) > 0 {
+		tableSchema.PrimaryKey = tableSchema.KeyColumns[0]
+	}
+
+	//| seq | name | unique | origin | partial |
+	rows, e = u.Db.Query(fmt.Sprintf("PRAGMA index_list(%s)", tableName))
+	if e != nil {
+		return nil, e
+	}
+	type indexInfo struct {
+		name     string
+		isUnique bool
+	}
+	var indice []indexInfo = make([]indexInfo, 0, 16)
+	for rows.Next() {
+		var seq, unique int
+		var name, origin string
+		var partial *int
+		e = rows.Scan(&seq, &name, &unique, &origin, &partial)
+		if e != nil {
+			rows.Close()
+			return nil, e
+		}
+		if origin == "pk" {
+			continue
+		}
+		indice = append(indice, indexInfo{name: name, isUnique: unique != 0})
+	}
+	rows.Close()
+
+	tableSchema.Indice = make([]*IndexSchema, 0, 32)
+	for _, ii := range indice {
+		is := new(IndexSchema)
+		is.Name = ii.name
+		is.IsUnique = ii.isUnique
+		is.Columns = make([]*ColumnSchema, 0, 4)
+
+		//| seqno | cid | name |
+		rows, e = u.Db.Query(fmt.Sprintf("PRAGMA index_info(%s)", ii.name))
+		if e != nil {
+			return nil, e
+		}
+		for rows.Next() {
+			var seqNo, cid int
+			var columnName *string
+			e = rows.Scan(&seqNo, &cid, &columnName)
+			if e != nil {
+				rows.Close()
+				return nil, e
+			}
+			var col *ColumnSchema
+			if columnName != nil {
+				col = tableSchema.ColumnByName(*columnName)
+			}
+			if col == nil { // expression index
+				is = nil
+				break
+			}
+			is.Columns = append(is.Columns, col)
+		}
+		rows.Close()
+		if is != nil && len(is.Columns) > 0 {
+			tableSchema.Indice = append(tableSchema.Indice, is)
+		}
+	}
+
+	//| id | seq | table | from | to | on_update | on_delete | match |
+	rows, e = u.Db.Query(fmt.Sprintf("PRAGMA foreign_key_list(%s)", tableName))
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+	tableSchema.ForeignKeys = make([]*ForeignKeySchema, 0, 4)
+	var fk *ForeignKeySchema
+	var lastId int = -1
+	for rows.Next() {
+		var id, seq int
+		var refTable, from, onUpdate, onDelete, match string
+		var to *string
+		e = rows.Scan(&id, &seq, &refTable, &from, &to, &onUpdate, &onDelete, &match)
+		if e != nil {
+			return nil, e
+		}
+		if fk == nil || id != lastId {
+			// SQLite does not report constraint names
+			fk = new(ForeignKeySchema)
+			fk.RefTable = refTable
+			fk.OnDeleteCascade = strings.ToUpper(onDelete) == "CASCADE"
+			tableSchema.ForeignKeys = append(tableSchema.ForeignKeys, fk)
+			lastId = id
+		}
+		col := tableSchema.ColumnByName(from)
+		if col == nil {
+			col = &ColumnSchema{Name: from}
+		}
+		fk.Columns = append(fk.Columns, col)
+		if to != nil {
+			fk.RefColumns = append(fk.RefColumns, *to)
+		}
+	}
+
+	return tableSchema, rows.Err()
+}
+
+func sqliteIndexName(tableName string, index *IndexSchema) string {
+	if len(index.Name) == 0 {
+		index.Name = fmt.Sprintf("%s_%s_IDX", strings.ToUpper(tableName), strings.ToUpper(strings.Join(index.ColumnNames(), "_")))
+	}
+	return index.Name
+}
+
+func sqliteCreateIndex(tableName string, index *IndexSchema) string {
+	var buffer bytes.Buffer
+	buffer.WriteString("CREATE")
+	if index.IsUnique {
+		buffer.WriteString(" UNIQUE")
+	}
+	buffer.WriteString(fmt.Sprintf(" INDEX %s ON %s (%s)", sqliteIndexName(tableName, index), tableName, strings.Join(index.ColumnNames(), ", ")))
+	return buffer.String()
+}
+
+func sqliteForeignKeyName(tableName string, fk *ForeignKeySchema) string {
+	if len(fk.Name) == 0 {
+		fk.Name = fmt.Sprintf("%s_%s_FK", strings.ToUpper(tableName), strings.ToUpper(strings.Join(fk.ColumnNames(), "_")))
+	}
+	return fk.Name
+}
+
+func sqliteCreateTable(schema *TableSchema, tableName string) string {
+	var buffer bytes.Buffer
+	var isSerial bool = schema.PrimaryKey != schema.ForeignKey && !schema.hasCompositeKey() &&
+		(schema.PrimaryKey.Type == Int32 || schema.PrimaryKey.Type == Int64)
+
+	buffer.WriteString(fmt.Sprintf("CREATE TABLE %s (\n", tableName))
+	for i, col := range schema.Columns {
+		if i > 0 {
+			buffer.WriteString(",\n")
+		}
+		if col == schema.PrimaryKey && isSerial {
+			// only INTEGER PRIMARY KEY becomes an alias of the rowid
+			buffer.WriteString(fmt.Sprintf("\t%s INTEGER PRIMARY KEY AUTOINCREMENT", col.Name))
+		} else {
+			buffer.WriteString(fmt.Sprintf("\t%s", sqliteColumnDefinition(col)))
+		}
+	}
+	if !isSerial {
+		buffer.WriteString(fmt.Sprintf(",\n\tPRIMARY KEY(%s)", strings.Join(schema.KeyColumnNames(), ", ")))
+	}
+	for _, fk := range schema.ForeignKeys {
+		// constraints can only be declared with the table
+		buffer.WriteString(fmt.Sprintf(",\n\tCONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)", sqliteForeignKeyName(tableName, fk),
+			strings.Join(fk.ColumnNames(), ", "), fk.RefTable, strings.Join(fk.RefColumns, ", ")))
+		if fk.OnDeleteCascade {
+			buffer.WriteString(" ON DELETE CASCADE")
+		}
+	}
+	buffer.WriteString("\n)")
+
+	return buffer.String()
+}
+
+// sqliteRebuildSchema applies the column and foreign key operations of a table rebuild to the database schema.
+// Columns added by ops are part of the table, modified columns take the class definition
+// and the other columns keep their database definition.
+func sqliteRebuildSchema(dbSchema *TableSchema, ops []*SchemaOperation) *TableSchema {
+	var ts *TableSchema = new(TableSchema)
+	ts.Name = dbSchema.Name
+	ts.Columns = make([]*ColumnSchema, 0, len(dbSchema.Columns)+len(ops))
+	ts.Columns = append(ts.Columns, dbSchema.Columns...)
+	ts.Indice = make([]*IndexSchema, 0, len(dbSchema.Indice))
+
+	var fks []*ForeignKeySchema = make([]*ForeignKeySchema, 0, len(dbSchema.ForeignKeys)+len(ops))
+	fks = append(fks, dbSchema.ForeignKeys...)
+	var keySchema *TableSchema = dbSchema
+	for _, op := range ops {
+		switch op.Type {
+		case OperationAddColumn:
+			ts.Columns = append(ts.Columns, op.Column)
+		case OperationModifyColumn:
+			for i, col := range ts.Columns {
+				if col.Name == op.Column.Name {
+					ts.Columns[i] = op.Column
+				}
+			}
+		case OperationAddForeignKey, OperationDropForeignKey:
+			var kept []*ForeignKeySchema = make([]*ForeignKeySchema, 0, len(fks)+1)
+			for _, fk := range fks {
+				if !fk.sameColumns(op.ForeignKey) {
+					kept = append(kept, fk)
+				}
+			}
+			if op.Type == OperationAddForeignKey {
+				kept = append(kept, op.ForeignKey)
+			}
+			fks = kept
+		default:
+			continue
+		}
+		if op.Schema != nil {
+			keySchema = op.Schema
+		}
+	}
+
+	lookup := func(name string) *ColumnSchema {
+		for _, col := range ts.Columns {
+			if col.Name == name {
+				return col
+			}
+		}
+		return nil
+	}
+
+	if keySchema.PrimaryKey != nil {
+		ts.PrimaryKey = lookup(keySchema.PrimaryKey.Name)
+	}
+	for _, col := range keySchema.KeyColumns {
+		ts.KeyColumns = append(ts.KeyColumns, lookup(col.Name))
+	}
+	if keySchema.ForeignKey != nil {
+		ts.ForeignKey = lookup(keySchema.ForeignKey.Name)
+	}
+	for _, idx := range dbSchema.Indice {
+		is := *idx
+		is.Columns = make([]*ColumnSchema, len(idx.Columns))
+		for i, col := range idx.Columns {
+			is.Columns[i] = lookup(col.Name)
+		}
+		ts.Indice = append(ts.Indice, &is)
+	}
+	ts.ForeignKeys = make([]*ForeignKeySchema, 0, len(fks))
+	for _, fk := range fks {
+		fkc := *fk
+		fkc.Columns = make([]*ColumnSchema, len(fk.Columns))
+		for i, col := range fk.Columns {
+			fkc.Columns[i] = lookup(col.Name)
+		}
+		ts.ForeignKeys = append(ts.ForeignKeys, &fkc)
+	}
+
+	return ts
+}
+
+const (
+	sqliteForeignKeysOff  = "PRAGMA foreign_keys = OFF"
+	sqliteForeignKeysOn   = "PRAGMA foreign_keys = ON"
+	sqliteForeignKeyCheck = "PRAGMA foreign_key_check"
+)
+
+// sqliteRebuildTable renders the statements to recreate a table with a new definition,
+// since SQLite cannot alter existing columns and constraints in place.
+// It follows the procedure documented for ALTER TABLE: with foreign keys off, dropping the table
+// neither fails on nor cascades to referencing rows, the copy is made in one transaction
+// and references are checked before commit. A copy left by a failed rebuild is dropped first.
+func sqliteRebuildTable(schema *TableSchema) []string {
+	var tmpName string = schema.Name + "__gorb_new"
+	var names []string = make([]string, len(schema.Columns))
+	for i, col := range schema.Columns {
+		names[i] = col.Name
+	}
+	var columns string = strings.Join(names, ", ")
+
+	var script []string = make([]string, 0, 10+len(schema.Indice))
+	script = append(script, sqliteForeignKeysOff, "BEGIN")
+	script = append(script, fmt.Sprintf("DROP TABLE IF EXISTS %s", tmpName))
+	script = append(script, sqliteCreateTable(schema, tmpName))
+	script = append(script, fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", tmpName, columns, columns, schema.Name))
+	script = append(script, fmt.Sprintf("DROP TABLE %s", schema.Name))
+	script = append(script, fmt.Sprintf("ALTER TABLE %s RENAME TO %s", tmpName, schema.Name))
+	for _, idx := range schema.Indice {
+		script = append(script, sqliteCreateIndex(schema.Name, idx))
+	}
+	script = append(script, sqliteForeignKeyCheck, "COMMIT", sqliteForeignKeysOn)
+	return script
+}
+
+// scriptRebuild renders one table rebuild for all column and foreign key operations in ops
+func (u *SqliteSchemaUpgrader) scriptRebuild(dbSchema *TableSchema, ops []*SchemaOperation) ([]string, error) {
+	if dbSchema == nil {
+		return nil, fmt.Errorf("SqliteSchemaUpgrader: Table %s schema is required to rebuild the table", ops[len(ops)-1].Table)
+	}
+	return sqliteRebuildTable(sqliteRebuildSchema(dbSchema, ops)), nil
+}
+
+func (u *SqliteSchemaUpgrader) ScriptOperation(op *SchemaOperation) ([]string, error) {
+	switch op.Type {
+	case OperationCreateTable:
+		var script []string = []string{sqliteCreateTable(op.Schema, op.Schema.Name)}
+		for _, idx := range op.Schema.Indice {
+			script = append(script, sqliteCreateIndex(op.Schema.Name, idx))
+		}
+		return script, nil
+
+	case OperationAddColumn:
+		// SQLite rejects NOT NULL columns without a default on populated tables
+		return []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", op.Table, sqliteColumnDefinition(op.Column))}, nil
+
+	case OperationAddIndex:
+		return []string{sqliteCreateIndex(op.Table, op.Index)}, nil
+
+	case OperationModifyColumn, OperationAddForeignKey, OperationDropForeignKey:
+		return u.scriptRebuild(op.DbSchema, []*SchemaOperation{op})
+
+	case OperationDropIndex:
+		return []string{fmt.Sprintf("DROP INDEX %s", op.Index.Name)}, nil
+
+	case OperationDropColumn:
+		// requires SQLite 3.35
+		return []string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", op.Table, op.Column.Name)}, nil
+
+	case OperationDropTable:
+		return []string{fmt.Sprintf("DROP TABLE %s", op.Table)}, nil
+
+	case OperationRenameTable:
+		return []string{fmt.Sprintf("ALTER TABLE %s RENAME TO %s", op.OldName, op.Table)}, nil
+
+	case OperationRenameColumn:
+		// requires SQLite 3.25
+		return []string{fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", op.Table, op.OldColumn.Name, op.Column.Name)}, nil
+	}
+
+	return nil, fmt.Errorf("SqliteSchemaUpgrader: Unsupported schema operation %s", op.Type)
+}
+
+func (u *SqliteSchemaUpgrader) execOperation(op *SchemaOperation) error {
+	script, e := u.ScriptOperation(op)
+	if e != nil {
+		return e
+	}
+	return u.execScript(script)
+}
+
+// execScript runs the statements of an operation on one connection, since PRAGMA foreign_keys
+// and the transaction of a table rebuild apply only to the connection executing them.
+// A failed rebuild is rolled back, foreign keys are restored to their previous setting.
+func (u *SqliteSchemaUpgrader) execScript(script []string) error {
+	if u.IsTestMode {
+		for _, query := range script {
+			e := writeStatement(u.Script, query)
+			if e != nil {
+				return e
+			}
+		}
+		return nil
+	}
+	if u.Db == nil {
+		return fmt.Errorf("SqliteSchemaUpgrader: Connection has not been set")
+	}
+	ctx := context.Background()
+	conn, e := u.Db.Conn(ctx)
+	if e != nil {
+		return e
+	}
+	defer conn.Close()
+
+	var foreignKeys int = -1
+	var inTxn bool
+	for _, query := range script {
+		if query == sqliteForeignKeysOff && foreignKeys < 0 {
+			e = conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys)
+			if e != nil {
+				break
+			}
+		}
+		if query == sqliteForeignKeyCheck {
+			e = sqliteCheckForeignKeys(ctx, conn)
+		} else {
+			_, e = conn.ExecContext(ctx, query)
+		}
+		if e != nil {
+			break
+		}
+		inTxn = (inTxn || query == "BEGIN") && query != "COMMIT"
+	}
+	if e != nil && inTxn {
+		conn.ExecContext(ctx, "ROLLBACK")
+	}
+	if foreignKeys >= 0 {
+		// the connection returns to the pool
+		_, ep := conn.ExecContext(ctx, fmt.Sprintf("PRAGMA foreign_keys = %d", foreignKeys))
+		if e == nil {
+			e = ep
+		}
+	}
+	return e
+}
+
+// sqliteCheckForeignKeys fails if PRAGMA foreign_key_check reports rows referencing missing rows
+func sqliteCheckForeignKeys(ctx context.Context, conn *sql.Conn) error {
+	//| table | rowid | parent | fkid |
+	rows, e := conn.QueryContext(ctx, sqliteForeignKeyCheck)
+	if e != nil {
+		return e
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var table, parent string
+		var rowId *int64
+		var fkId int
+		e = rows.Scan(&table, &rowId, &parent, &fkId)
+		if e != nil {
+			return e
+		}
+		return fmt.Errorf("Table %s has rows referencing missing rows of %s", table, parent)
+	}
+	return rows.Err()
+}
+
+func (u *SqliteSchemaUpgrader) CreateTable(schema *TableSchema) error {
+	return u.execOperation(&SchemaOperation{Type: OperationCreateTable, Table: schema.Name, Schema: schema})
+}
+
+func (u *SqliteSchemaUpgrader) AlterTableAddColumn(tableName string, column *ColumnSchema) error {
+	return u.execOperation(&SchemaOperation{Type: OperationAddColumn, Table: tableName, Column: column})
+}
+
+func (u *SqliteSchemaUpgrader) AlterTableAddIndex(tableName string, index *IndexSchema) error {
+	return u.execOperation(&SchemaOperation{Type: OperationAddIndex, Table: tableName, Index: index})
+}
+
+func (u *SqliteSchemaUpgrader) AlterTableModifyColumn(tableName string, column *ColumnSchema) error {
+	dbSchema, e := u.ReadTableSchema(tableName)
+	if e != nil {
+		return e
+	}
+	return u.execOperation(&SchemaOperation{Type: OperationModifyColumn, Table: tableName, DbSchema: dbSchema, Column: column})
+}
+
+func (u *SqliteSchemaUpgrader) AlterTableDropColumn(tableName string, columnName string) error {
+	return u.execOperation(&SchemaOperation{Type: OperationDropColumn, Table: tableName, Column: &ColumnSchema{Name: columnName}})
+}
+
+func (u *SqliteSchemaUpgrader) AlterTableDropIndex(tableName string, indexName string) error {
+	return u.execOperation(&SchemaOperation{Type: OperationDropIndex, Table: tableName, Index: &IndexSchema{Name: indexName}})
+}
+
+func (u *SqliteSchemaUpgrader) AlterTableAddForeignKey(tableName string, fk *ForeignKeySchema) error {
+	dbSchema, e := u.ReadTableSchema(tableName)
+	if e != nil {
+		return e
+	}
+	return u.execOperation(&SchemaOperation{Type: OperationAddForeignKey, Table: tableName, DbSchema: dbSchema, ForeignKey: fk})
+}
+
+func (u *SqliteSchemaUpgrader) AlterTableDropForeignKey(tableName string, fk *ForeignKeySchema) error {
+	dbSchema, e := u.ReadTableSchema(tableName)
+	if e != nil {
+		return e
+	}
+	return u.execOperation(&SchemaOperation{Type: OperationDropForeignKey, Table: tableName, DbSchema: dbSchema, ForeignKey: fk})
+}
+
+func (u *SqliteSchemaUpgrader) AlterTableRenameColumn(tableName string, oldName string, newName string) error {
+	return u.execOperation(&SchemaOperation{Type: OperationRenameColumn, Table: tableName, Column: &ColumnSchema{Name: newName}, OldColumn: &ColumnSchema{Name: oldName}})
+}
+
+func (u *SqliteSchemaUpgrader) RenameTable(oldName string, newName string) error {
+	return u.execOperation(&SchemaOperation{Type: OperationRenameTable, Table: newName, OldName: oldName})
+}
+
+func (u *SqliteSchemaUpgrader) DropTable(tableName string) error {
+	return u.execOperation(&SchemaOperation{Type: OperationDropTable, Table: tableName})
+}
@@ -0,0 +1,1347 @@
+package gorb
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSchemaDriver keeps table schemas in memory and records executed queries
+type fakeSchemaDriver struct {
+	tables  map[string]*TableSchema
+	version int32
+	queries []string
+}
+
+func newFakeSchemaDriver() *fakeSchemaDriver {
+	return &fakeSchemaDriver{tables: make(map[string]*TableSchema)}
+}
+
+func (f *fakeSchemaDriver) GetVersion() int32 {
+	return f.version
+}
+func (f *fakeSchemaDriver) SetVersion(version int32) error {
+	f.version = version
+	return nil
+}
+func (f *fakeSchemaDriver) ExecQuery(query string) error {
+	f.queries = append(f.queries, query)
+	return nil
+}
+func (f *fakeSchemaDriver) ReadTableSchema(tableName string) (*TableSchema, error) {
+	ts, ok := f.tables[tableName]
+	if !ok {
+		return nil, fmt.Errorf("Table %s does not exist", tableName)
+	}
+	return ts, nil
+}
+func (f *fakeSchemaDriver) CreateTable(schema *TableSchema) error {
+	f.tables[schema.Name] = schema
+	return nil
+}
+func (f *fakeSchemaDriver) AlterTableAddColumn(tableName string, column *ColumnSchema) error {
+	ts := f.tables[tableName]
+	ts.Columns = append(ts.Columns, column)
+	return nil
+}
+func (f *fakeSchemaDriver) AlterTableAddIndex(tableName string, index *IndexSchema) error {
+	ts := f.tables[tableName]
+	ts.Indice = append(ts.Indice, index)
+	return nil
+}
+
+func (f *fakeSchemaDriver) AlterTableModifyColumn(tableName string, column *ColumnSchema) error {
+	ts := f.tables[tableName]
+	for i, col := range ts.Columns {
+		if col.Name == column.Name {
+			ts.Columns[i] = column
+		}
+	}
+	return nil
+}
+
+func (f *fakeSchemaDriver) ReadTableNames() ([]string, error) {
+	var names []string
+	for name := range f.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+func (f *fakeSchemaDriver) AlterTableDropColumn(tableName string, columnName string) error {
+	return nil
+}
+func (f *fakeSchemaDriver) AlterTableDropIndex(tableName string, indexName string) error {
+	return nil
+}
+func (f *fakeSchemaDriver) AlterTableAddForeignKey(tableName string, fk *ForeignKeySchema) error {
+	ts := f.tables[tableName]
+	ts.ForeignKeys = append(ts.ForeignKeys, fk)
+	return nil
+}
+func (f *fakeSchemaDriver) AlterTableDropForeignKey(tableName string, fk *ForeignKeySchema) error {
+	return nil
+}
+func (f *fakeSchemaDriver) AlterTableRenameColumn(tableName string, oldName string, newName string) error {
+	return nil
+}
+func (f *fakeSchemaDriver) RenameTable(oldName string, newName string) error {
+	f.tables[newName] = f.tables[oldName]
+	delete(f.tables, oldName)
+	return nil
+}
+func (f *fakeSchemaDriver) DropTable(tableName string) error {
+	delete(f.tables, tableName)
+	return nil
+}
+
+func (f *fakeSchemaDriver) ScriptOperation(op *SchemaOperation) ([]string, error) {
+	switch op.Type {
+	case OperationCreateTable:
+		return []string{"CREATE " + op.Schema.Name}, nil
+	case OperationAddColumn:
+		return []string{"ADD " + op.Table + "." + op.Column.Name}, nil
+	case OperationAddIndex:
+		return []string{"INDEX " + op.Table + "." + strings.Join(op.Index.ColumnNames(), "+")}, nil
+	case OperationModifyColumn:
+		return []string{"MODIFY " + op.Table + "." + op.Column.Name}, nil
+	case OperationDropIndex:
+		return []string{"DROP INDEX " + op.Table + "." + op.Index.Name}, nil
+	case OperationDropColumn:
+		return []string{"DROP " + op.Table + "." + op.Column.Name}, nil
+	case OperationDropTable:
+		return []string{"DROP " + op.Table}, nil
+	case OperationAddForeignKey:
+		return []string{"FK " + op.Table + "." + strings.Join(op.ForeignKey.ColumnNames(), "+")}, nil
+	case OperationDropForeignKey:
+		return []string{"DROP FK " + op.Table + "." + strings.Join(op.ForeignKey.ColumnNames(), "+")}, nil
+	case OperationRenameTable:
+		return []string{"RENAME " + op.OldName + " " + op.Table}, nil
+	case OperationRenameColumn:
+		return []string{"RENAME " + op.Table + "." + op.OldColumn.Name + " " + op.Column.Name}, nil
+	}
+	return nil, fmt.Errorf("Unsupported schema operation %s", op.Type)
+}
+
+// fakeFailingDriver fails to read table schemas of existing tables
+type fakeFailingDriver struct {
+	*fakeSchemaDriver
+}
+
+func (f *fakeFailingDriver) ReadTableSchema(tableName string) (*TableSchema, error) {
+	return nil, fmt.Errorf("Access denied for table %s", tableName)
+}
+
+type (
+	scOrder struct {
+		Id       int64         `gorb:"id,pk"`
+		Customer string        `gorb:"customer,:40,index"`
+		Note     *string       `gorb:"note"`
+		Lines    []*scLineItem `gorb:"sc_line"`
+	}
+	scLineItem struct {
+		Id      int64  `gorb:"id,pk"`
+		OrderId int64  `gorb:"order_id,fk"`
+		Sku     string `gorb:"sku,:20"`
+	}
+)
+
+func registerScOrder(t *testing.T) *Entity {
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(scOrder{}), "sc_order")
+	if e != nil {
+		t.Fatal(e)
+	}
+	return ent
+}
+
+func TestPlanEntity(t *testing.T) {
+	ent := registerScOrder(t)
+	drv := newFakeSchemaDriver()
+	drv.CreateTable(&TableSchema{
+		Name:    "sc_order",
+		Columns: []*ColumnSchema{{Name: "id", Type: Int64}, {Name: "customer", Type: String, Precision: 40}},
+	})
+	su := &SchemaUpgrader{SqlDmlDriver: drv}
+
+	plan, e := su.PlanEntity(ent)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(drv.queries) > 0 {
+		t.Error("plan executed statements")
+	}
+	var buf bytes.Buffer
+	plan.WriteScript(&buf)
+	expected := "-- sc_order\nADD sc_order.note;\nINDEX sc_order.customer;\n\n-- sc_line\nCREATE sc_line;\n\n"
+	if buf.String() != expected {
+		t.Error(buf.String())
+	}
+	if !plan.Tables[1].IsNew || plan.Tables[0].IsNew {
+		t.Fail()
+	}
+	if _, e = (&SchemaUpgrader{SqlDmlDriver: &fakeFailingDriver{fakeSchemaDriver: drv}}).PlanEntity(ent); e == nil {
+		t.Error("read error planned as missing table")
+	}
+
+	if e = su.ApplyPlan(plan); e != nil {
+		t.Fatal(e)
+	}
+	if len(drv.queries) != 3 {
+		t.Error(drv.queries)
+	}
+
+	buf.Reset()
+	lite := &SqliteSchemaUpgrader{IsTestMode: true, Script: &buf}
+	lite.ExecQuery("DROP TABLE sc_line")
+	lite.SetVersion(2)
+	if buf.String() != "DROP TABLE sc_line;\nINSERT INTO "+SchemaVersionTable+" (version) VALUES (2);\n" {
+		t.Error(buf.String())
+	}
+}
+
+func TestSqliteColumnTypes(t *testing.T) {
+	for _, col := range []*ColumnSchema{
+		{Name: "a", Type: Bool},
+		{Name: "b", Type: Int8, IsUnsigned: true},
+		{Name: "c", Type: Int16},
+		{Name: "d", Type: Int32},
+		{Name: "e", Type: Int64, IsNull: true},
+		{Name: "f", Type: Float},
+		{Name: "g", Type: String, Precision: 40},
+		{Name: "h", Type: String},
+		{Name: "i", Type: DateTime},
+		{Name: "j", Type: Blob, IsNull: true},
+		{Name: "k", Type: Decimal, Precision: 12, Scale: 2},
+		{Name: "l", Type: Json},
+	} {
+		def := sqliteColumnDefinition(col)
+		columnType := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(def, col.Name+" "), " NOT NULL"), " NULL")
+		dt, precision, scale := sqliteColumnType(columnType)
+		if dt != col.Type || precision != col.Precision || scale != col.Scale {
+			t.Error(def, dt, precision, scale)
+		}
+		if isUnsigned := strings.Contains(strings.ToLower(columnType), "unsigned"); isUnsigned != col.IsUnsigned {
+			t.Error(def, "unsigned", isUnsigned)
+		}
+	}
+
+	// serial keys are declared INTEGER PRIMARY KEY whatever the field type and read back as Int64
+	var lite SqliteSchemaUpgrader
+	ts := &TableSchema{Name: "sc_serial", Columns: []*ColumnSchema{{Name: "id", Type: Int32}}}
+	ts.PrimaryKey = ts.Columns[0]
+	script, _ := lite.ScriptOperation(&SchemaOperation{Type: OperationCreateTable, Schema: ts})
+	if !strings.Contains(script[0], "id INTEGER PRIMARY KEY AUTOINCREMENT") {
+		t.Error(script[0])
+	}
+	if dt, _, _ := sqliteColumnType("INTEGER"); dt != Int64 {
+		t.Error("INTEGER", dt)
+	}
+	if dt, _, _ := sqliteColumnType("INT"); dt != Int32 {
+		t.Error("INT", dt)
+	}
+}
+
+func TestPlanModifyColumn(t *testing.T) {
+	ent := registerScOrder(t)
+	drv := newFakeSchemaDriver()
+	drv.CreateTable(&TableSchema{
+		Name: "sc_order",
+		Columns: []*ColumnSchema{{Name: "id", Type: Int64},
+			{Name: "customer", Type: String, Precision: 60, IsNull: true},
+			{Name: "note", Type: String, Precision: 200, IsNull: true}},
+		Indice: []*IndexSchema{{Name: "IDX", Columns: []*ColumnSchema{{Name: "customer"}}}},
+	})
+	drv.CreateTable(&TableSchema{
+		Name:    "sc_line",
+		Columns: []*ColumnSchema{{Name: "id", Type: Int64}, {Name: "order_id", Type: Int32}, {Name: "sku", Type: String, Precision: 20}},
+		Indice:  []*IndexSchema{{Name: "IDX", Columns: []*ColumnSchema{{Name: "order_id"}}}},
+	})
+	su := &SchemaUpgrader{SqlDmlDriver: drv}
+
+	plan, e := su.PlanEntity(ent)
+	if e != nil {
+		t.Fatal(e)
+	}
+	ops := plan.Operations()
+	if len(ops) != 3 {
+		t.Fatal(ops)
+	}
+	if ops[0].Column.Name != "customer" || !ops[0].IsLossy {
+		t.Error("narrowing not flagged", ops[0].Warning)
+	}
+	if ops[1].Column.Name != "note" || ops[1].IsLossy {
+		t.Error("widening flagged", ops[1].Warning)
+	}
+	if ops[2].Column.Name != "order_id" || ops[2].IsLossy {
+		t.Error("Int32 to Int64 flagged", ops[2].Warning)
+	}
+
+	if su.ApplyPlan(plan) == nil || len(drv.queries) > 0 {
+		t.Error("lossy plan applied")
+	}
+	su.AllowDataLoss = true
+	if e = su.ApplyPlan(plan); e != nil || len(drv.queries) != 3 {
+		t.Error(e, drv.queries)
+	}
+
+	// one SQLite rebuild applies both column modifications of sc_order
+	tp := &TablePlan{Table: "sc_order"}
+	customer, note := *ops[0], *ops[1]
+	tp.addOperation(&SqliteSchemaUpgrader{}, &customer)
+	tp.addOperation(&SqliteSchemaUpgrader{}, &note)
+	if len(customer.Sql) == 0 || len(note.Sql) != 0 {
+		t.Error(customer.Sql, note.Sql)
+	}
+	var buf bytes.Buffer
+	(&SchemaPlan{Tables: []*TablePlan{tp}}).WriteScript(&buf)
+	if strings.Count(buf.String(), "CREATE TABLE sc_order__gorb_new") != 1 {
+		t.Error(buf.String())
+	}
+}
+
+type (
+	scProject struct {
+		Id     int64     `gorb:"id,pk"`
+		Name   string    `gorb:"name,:80"`
+		Budget float64   `gorb:"budget"`
+		Tasks  []*scTask `gorb:"sc_task"`
+	}
+	scTask struct {
+		Id        int64  `gorb:"id,pk"`
+		ProjectId int64  `gorb:"project_id,fk=cascade"`
+		Title     string `gorb:"title,:200"`
+	}
+
+	// fakeSqliteDriver reads table schemas from memory, renders and executes statements as SQLite
+	fakeSqliteDriver struct {
+		*fakeSchemaDriver
+		lite *SqliteSchemaUpgrader
+	}
+
+	// scSqlDriver is a database/sql driver recording statements with the connection executing them,
+	// PRAGMA foreign_key_check returns scViolations
+	scSqlDriver struct{}
+	scSqlConn   struct{ id int }
+	scSqlStmt   struct {
+		conn  *scSqlConn
+		query string
+	}
+	scSqlRows struct {
+		columns int
+		values  [][]driver.Value
+	}
+)
+
+var (
+	scSqlConns   int
+	scSqlLog     []string
+	scViolations [][]driver.Value
+)
+
+func init() {
+	sql.Register("gorb_sc", scSqlDriver{})
+}
+
+func (f *fakeSqliteDriver) ScriptOperation(op *SchemaOperation) ([]string, error) {
+	return f.lite.ScriptOperation(op)
+}
+func (f *fakeSqliteDriver) scriptRebuild(dbSchema *TableSchema, ops []*SchemaOperation) ([]string, error) {
+	return f.lite.scriptRebuild(dbSchema, ops)
+}
+func (f *fakeSqliteDriver) execScript(script []string) error {
+	return f.lite.execScript(script)
+}
+
+func (d scSqlDriver) Open(name string) (driver.Conn, error) {
+	scSqlConns++
+	return &scSqlConn{id: scSqlConns}, nil
+}
+func (c *scSqlConn) Prepare(query string) (driver.Stmt, error) {
+	return &scSqlStmt{conn: c, query: query}, nil
+}
+func (c *scSqlConn) Close() error {
+	return nil
+}
+func (c *scSqlConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("Transactions are not supported")
+}
+func (s *scSqlStmt) Close() error {
+	return nil
+}
+func (s *scSqlStmt) NumInput() int {
+	return -1
+}
+func (s *scSqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	scSqlLog = append(scSqlLog, fmt.Sprintf("%d:%s", s.conn.id, s.query))
+	return driver.RowsAffected(0), nil
+}
+func (s *scSqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	scSqlLog = append(scSqlLog, fmt.Sprintf("%d:%s", s.conn.id, s.query))
+	switch s.query {
+	case "PRAGMA foreign_keys":
+		return &scSqlRows{columns: 1, values: [][]driver.Value{{int64(1)}}}, nil
+	case sqliteForeignKeyCheck:
+		return &scSqlRows{columns: 4, values: scViolations}, nil
+	}
+	return nil, fmt.Errorf("Unsupported query %s", s.query)
+}
+func (r *scSqlRows) Columns() []string {
+	return make([]string, r.columns)
+}
+func (r *scSqlRows) Close() error {
+	return nil
+}
+func (r *scSqlRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// scSqlStatements returns the logged statements, all of them have to be executed on one connection
+func scSqlStatements(t *testing.T) []string {
+	var statements []string = make([]string, len(scSqlLog))
+	for i, entry := range scSqlLog {
+		pos := strings.Index(entry, ":")
+		if entry[:pos] != scSqlLog[0][:strings.Index(scSqlLog[0], ":")] {
+			t.Error("statement on another connection", entry)
+		}
+		statements[i] = entry[pos+1:]
+	}
+	scSqlLog = nil
+	return statements
+}
+
+func TestSqliteRebuild(t *testing.T) {
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(scProject{}), "sc_project")
+	if e != nil {
+		t.Fatal(e)
+	}
+	su := &SchemaUpgrader{ForeignKeys: true}
+
+	// budget is kept as read from the database, Float fields may map decimal columns
+	drv := newFakeSchemaDriver()
+	project := &TableSchema{Name: "sc_project", Columns: []*ColumnSchema{{Name: "id", Type: Int64, declaredType: "INTEGER"},
+		{Name: "name", Type: String, Precision: 40}, {Name: "budget", Type: Decimal, Precision: 10, Scale: 2, declaredType: "NUMERIC(10,2)"}}}
+	project.PrimaryKey = project.Columns[0]
+	drv.CreateTable(project)
+	// rows of sc_task are deleted with their project
+	task := su.GetSchemaForChild(ent.Children[0])
+	task.ColumnByName("title").Precision = 100
+	task.ForeignKeys[0].OnDeleteCascade = false
+	drv.CreateTable(task)
+
+	db, e := sql.Open("gorb_sc", "")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer db.Close()
+	su.SqlDmlDriver = &fakeSqliteDriver{fakeSchemaDriver: drv, lite: &SqliteSchemaUpgrader{Db: db}}
+	plan, e := su.PlanEntity(ent)
+	if e != nil {
+		t.Fatal(e)
+	}
+	projectOps, taskOps := plan.Tables[0].Operations, plan.Tables[1].Operations
+	if len(projectOps) != 1 || len(taskOps) != 3 {
+		t.Fatal(plan.Operations())
+	}
+	rebuild := strings.Join(projectOps[0].Sql, ";\n")
+	if !strings.Contains(rebuild, "\tname VARCHAR(80) NOT NULL,\n\tbudget NUMERIC(10,2) NOT NULL\n") {
+		t.Error(rebuild)
+	}
+	// the column modification and the recreated foreign key share one rebuild
+	if taskOps[0].Type != OperationModifyColumn || len(taskOps[1].Sql) != 0 || len(taskOps[2].Sql) != 0 {
+		t.Error(taskOps)
+	}
+	rebuild = strings.Join(taskOps[0].Sql, ";\n")
+	if !strings.Contains(rebuild, "title VARCHAR(200)") || !strings.Contains(rebuild, "REFERENCES sc_project (id) ON DELETE CASCADE") {
+		t.Error(rebuild)
+	}
+
+	scSqlLog = nil
+	if e = su.ApplyPlan(plan); e != nil {
+		t.Fatal(e)
+	}
+	statements := scSqlStatements(t)
+	expected := []string{"PRAGMA foreign_keys", sqliteForeignKeysOff, "BEGIN", "DROP TABLE IF EXISTS sc_project__gorb_new"}
+	if !reflect.DeepEqual(statements[:4], expected) {
+		t.Error(statements)
+	}
+	expected = []string{"ALTER TABLE sc_project__gorb_new RENAME TO sc_project", sqliteForeignKeyCheck, "COMMIT", sqliteForeignKeysOn, "PRAGMA foreign_keys = 1"}
+	if len(statements) != len(projectOps[0].Sql)+len(taskOps[0].Sql)+4 || !reflect.DeepEqual(statements[7:12], expected) {
+		t.Error(statements)
+	}
+
+	// rows referencing missing projects roll the rebuild back
+	scViolations = [][]driver.Value{{"sc_task", int64(1), "sc_project", int64(0)}}
+	defer func() {
+		scViolations = nil
+	}()
+	if e = su.ApplyPlan(plan); e == nil || !strings.Contains(e.Error(), "sc_task") {
+		t.Error(e)
+	}
+	statements = scSqlStatements(t)
+	if statements[len(statements)-3] != sqliteForeignKeyCheck || statements[len(statements)-2] != "ROLLBACK" ||
+		statements[len(statements)-1] != "PRAGMA foreign_keys = 1" {
+		t.Error(statements)
+	}
+}
+
+func TestPlanDrops(t *testing.T) {
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(scOrder{}), "sc_order")
+	if e != nil {
+		t.Fatal(e)
+	}
+	drv := newFakeSchemaDriver()
+	drv.CreateTable(&TableSchema{
+		Name: "sc_order",
+		Columns: []*ColumnSchema{{Name: "id", Type: Int64},
+			{Name: "customer", Type: String, Precision: 40},
+			{Name: "note", Type: String, IsNull: true},
+			{Name: "legacy", Type: Int32}},
+		Indice: []*IndexSchema{{Name: "C_IDX", Columns: []*ColumnSchema{{Name: "customer"}}}, {Name: "L_IDX", Columns: []*ColumnSchema{{Name: "legacy"}}}},
+	})
+	drv.CreateTable(&TableSchema{Name: "sc_line"})
+	drv.CreateTable(&TableSchema{Name: "sc_old_line"})
+	drv.CreateTable(&TableSchema{Name: "app_audit"})
+	su := &SchemaUpgrader{SqlDmlDriver: drv}
+
+	plan, _ := su.PlanEntity(ent)
+	if len(plan.Tables[0].Operations) != 0 {
+		t.Error("drops planned without DropUnmapped")
+	}
+
+	su.DropUnmapped = true
+	plan, _ = su.PlanEntity(ent)
+	ops := plan.Tables[0].Operations
+	if len(ops) != 2 || ops[0].Type != OperationDropIndex || ops[1].Type != OperationDropColumn || ops[1].Column.Name != "legacy" {
+		t.Error(ops)
+	}
+
+	if _, e = su.PlanOrphanedTables(&m); e == nil {
+		t.Error("orphaned tables planned without prefix")
+	}
+	plan, e = su.PlanOrphanedTables(&m, "sc_")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(plan.Tables) != 1 || plan.Tables[0].Table != "sc_old_line" {
+		t.Error(plan.Tables)
+	}
+	if su.ApplyPlan(plan) == nil {
+		t.Error("table dropped without AllowDataLoss")
+	}
+}
+
+type scAccount struct {
+	Id     int64  `gorb:"id,pk"`
+	Email  string `gorb:"email,:120,unique"`
+	Tenant int32  `gorb:"tenant,index=By_Tenant"`
+	Login  string `gorb:"login,:40,unique=by_tenant"`
+}
+
+func TestCompositeIndex(t *testing.T) {
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(scAccount{}), "account")
+	if e != nil {
+		t.Fatal(e)
+	}
+	su := &SchemaUpgrader{}
+	ts := su.GetSchemaForEntity(ent)
+	if len(ts.Indice) != 2 {
+		t.Fatal(ts.Indice)
+	}
+	if !ts.Indice[0].IsUnique || strings.Join(ts.Indice[0].ColumnNames(), ",") != "email" {
+		t.Error("unique index", ts.Indice[0])
+	}
+	if !ts.Indice[1].IsUnique || strings.Join(ts.Indice[1].ColumnNames(), ",") != "tenant,login" || ts.Indice[1].Name != "ACCOUNT_BY_TENANT_IDX" {
+		t.Error("composite index", ts.Indice[1])
+	}
+
+	drv := newFakeSchemaDriver()
+	db := su.GetSchemaForEntity(ent)
+	db.Indice[1].IsUnique = false
+	drv.CreateTable(db)
+	su.SqlDmlDriver = drv
+	plan, _ := su.PlanEntity(ent)
+	ops := plan.Operations()
+	if len(ops) != 2 || ops[0].Type != OperationDropIndex || ops[1].Type != OperationAddIndex {
+		t.Error(ops)
+	}
+}
+
+type (
+	scTicket struct {
+		Id    int64           `gorb:"id,pk"`
+		Notes []*scTicketNote `gorb:"sc_ticket_note"`
+	}
+	scTicketNote struct {
+		Id       int64  `gorb:"id,pk"`
+		TicketId int64  `gorb:"ticket_id,fk=cascade"`
+		Text     string `gorb:"text"`
+	}
+)
+
+func TestForeignKeys(t *testing.T) {
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(scTicket{}), "sc_ticket")
+	if e != nil {
+		t.Fatal(e)
+	}
+	child := ent.Children[0]
+	if !child.OnDeleteCascade || child.Parent() != &ent.Table {
+		t.Fatal("fk=cascade not parsed")
+	}
+
+	su := &SchemaUpgrader{}
+	if len(su.GetSchemaForChild(child).ForeignKeys) != 0 {
+		t.Error("foreign keys created without ForeignKeys")
+	}
+	su.ForeignKeys = true
+	ts := su.GetSchemaForChild(child)
+	if len(ts.ForeignKeys) != 1 {
+		t.Fatal(ts.ForeignKeys)
+	}
+	fk := ts.ForeignKeys[0]
+	if fk.Name != "SC_TICKET_NOTE_TICKET_ID_FK" || fk.RefTable != "sc_ticket" || fk.RefColumns[0] != "id" || !fk.OnDeleteCascade {
+		t.Error(fk)
+	}
+
+	var my MySqlSchemaUpgrader
+	script, _ := my.ScriptOperation(&SchemaOperation{Type: OperationCreateTable, Schema: (&SchemaUpgrader{}).GetSchemaForEntity(ent)})
+	if !strings.Contains(script[0], "\tid SERIAL,") {
+		t.Error(script[0])
+	}
+	script, _ = my.ScriptOperation(&SchemaOperation{Type: OperationCreateTable, Schema: su.GetSchemaForEntity(ent)})
+	if !strings.Contains(script[0], "\tid Bigint Not Null Auto_Increment,") {
+		t.Error(script[0])
+	}
+	script, _ = my.ScriptOperation(&SchemaOperation{Type: OperationCreateTable, Schema: ts})
+	if script[len(script)-1] != "Alter Table sc_ticket_note Add Constraint SC_TICKET_NOTE_TICKET_ID_FK Foreign Key (ticket_id) References sc_ticket (id) On Delete Cascade" {
+		t.Error(script)
+	}
+	var lite SqliteSchemaUpgrader
+	script, _ = lite.ScriptOperation(&SchemaOperation{Type: OperationCreateTable, Schema: ts})
+	if !strings.Contains(script[0], "CONSTRAINT SC_TICKET_NOTE_TICKET_ID_FK FOREIGN KEY (ticket_id) REFERENCES sc_ticket (id) ON DELETE CASCADE") {
+		t.Error(script[0])
+	}
+
+	drv := newFakeSchemaDriver()
+	drv.CreateTable(su.GetSchemaForEntity(ent))
+	db := su.GetSchemaForChild(child)
+	db.ForeignKeys[0].OnDeleteCascade = false
+	drv.CreateTable(db)
+	su.SqlDmlDriver = drv
+	plan, _ := su.PlanEntity(ent)
+	ops := plan.Operations()
+	if len(ops) != 2 || ops[0].Type != OperationDropForeignKey || ops[1].Type != OperationAddForeignKey {
+		t.Error(ops)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	drv := newFakeSchemaDriver()
+	drv.version = 1
+	su := &SchemaUpgrader{SqlDmlDriver: drv}
+
+	var applied []int32
+	su.RegisterMigration(3, "third", func(driver DbSchemaUpgrader) error {
+		applied = append(applied, 3)
+		return nil
+	})
+	su.RegisterMigrationSql(2, "second", "UPDATE a SET b = 1")
+	su.RegisterMigration(1, "first", func(driver DbSchemaUpgrader) error {
+		applied = append(applied, 1)
+		return nil
+	})
+	if su.RegisterMigrationSql(2, "duplicate", "SELECT 1") == nil {
+		t.Error("duplicate migration version accepted")
+	}
+
+	if e := su.Migrate(); e != nil {
+		t.Fatal(e)
+	}
+	if len(applied) != 1 || applied[0] != 3 || drv.version != 3 {
+		t.Error("unexpected migrations applied", applied, drv.version)
+	}
+	if len(drv.queries) != 1 || drv.queries[0] != "UPDATE a SET b = 1" {
+		t.Error("unexpected queries", drv.queries)
+	}
+
+	if e := su.Migrate(); e != nil || len(applied) != 1 {
+		t.Error("migrations are not idempotent")
+	}
+
+	// the database is not touched while the version table does not exist
+	if version, e := readSchemaVersion(nil, []string{"sc_order", "GORB_SCHEMA_LOCK"}); version != 0 || e != nil {
+		t.Error(version, e)
+	}
+}
+
+type scSetting struct {
+	Id      int64     `gorb:"id,pk"`
+	Name    string    `gorb:"name,:40,default='it''s'"`
+	Ratio   float64   `gorb:"ratio,default=0.50"`
+	Enabled bool      `gorb:"enabled,default=true"`
+	Changed time.Time `gorb:"changed,default=now()"`
+}
+
+func TestColumnDefault(t *testing.T) {
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(scSetting{}), "sc_setting")
+	if e != nil {
+		t.Fatal(e)
+	}
+	su := &SchemaUpgrader{}
+	ts := su.GetSchemaForEntity(ent)
+	if d := mySqlColumnDefinition(ts.ColumnByName("name")); d != "name Varchar(40) Not Null Default 'it''s'" {
+		t.Error(d)
+	}
+	if d := sqliteColumnDefinition(ts.ColumnByName("changed")); d != "changed DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP" {
+		t.Error(d)
+	}
+
+	db := &ColumnSchema{Name: "ratio", Type: Float}
+	db.readDefault(&[]string{"0.5"}[0])
+	if differs, _, _ := compareColumn(ts.ColumnByName("ratio"), db); differs {
+		t.Error("same default differs", db.Default)
+	}
+	db = &ColumnSchema{Name: "enabled", Type: Bool}
+	db.readDefault(&[]string{"b'0'"}[0])
+	if differs, lossy, _ := compareColumn(ts.ColumnByName("enabled"), db); !differs || lossy {
+		t.Error("changed default not detected", db.Default)
+	}
+
+	type badDefault struct {
+		Id    int64 `gorb:"id,pk"`
+		Count int32 `gorb:"count,default=many"`
+	}
+	if _, e = m.RegisterEntity(reflect.TypeOf(badDefault{}), "sc_bad"); e == nil {
+		t.Error("invalid default accepted")
+	}
+}
+
+type scSensor struct {
+	Id      uint64 `gorb:"id,pk"`
+	Level   int8   `gorb:"level"`
+	Flags   uint8  `gorb:"flags"`
+	Reading *int16 `gorb:"reading"`
+	Port    uint16 `gorb:"port"`
+	Count   uint32 `gorb:"count"`
+	Total   uint64 `gorb:"total,unsigned"`
+}
+
+func TestSmallIntegers(t *testing.T) {
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(scSensor{}), "sc_sensor")
+	if e != nil {
+		t.Fatal(e)
+	}
+	ts := (&SchemaUpgrader{}).GetSchemaForEntity(ent)
+	for name, def := range map[string]string{
+		"level":   "level Tinyint Not Null",
+		"flags":   "flags Tinyint Unsigned Not Null",
+		"reading": "reading Smallint Null",
+		"port":    "port Smallint Unsigned Not Null",
+		"count":   "count Integer Not Null",
+		"total":   "total Bigint Unsigned Not Null",
+	} {
+		if d := mySqlColumnDefinition(ts.ColumnByName(name)); d != def {
+			t.Error(d)
+		}
+	}
+	if d := sqliteColumnDefinition(ts.ColumnByName("port")); d != "port SMALLINT UNSIGNED NOT NULL" {
+		t.Error(d)
+	}
+	if dt, _, _ := mySqlColumnType("tinyint(1)"); dt != Bool {
+		t.Error("tinyint(1)", dt)
+	}
+	if dt, _, _ := mySqlColumnType("tinyint unsigned"); dt != Int8 || !mySqlIsUnsigned("tinyint unsigned") {
+		t.Error("tinyint unsigned", dt)
+	}
+
+	db := &ColumnSchema{Name: "port", Type: Int8, IsUnsigned: true}
+	if differs, lossy, _ := compareColumn(ts.ColumnByName("port"), db); !differs || lossy {
+		t.Error("Unsigned Int8 to Unsigned Int16 flagged")
+	}
+	db = &ColumnSchema{Name: "port", Type: Int16}
+	if differs, lossy, _ := compareColumn(ts.ColumnByName("port"), db); !differs || !lossy {
+		t.Error("Int16 to Unsigned Int16 not flagged")
+	}
+	db = &ColumnSchema{Name: "port", Type: Int8}
+	if differs, lossy, _ := compareColumn(ts.ColumnByName("port"), db); !differs || lossy {
+		t.Error("Int8 to Unsigned Int16 flagged")
+	}
+	db = &ColumnSchema{Name: "reading", Type: Int8, IsUnsigned: true, IsNull: true}
+	if differs, lossy, _ := compareColumn(ts.ColumnByName("reading"), db); !differs || lossy {
+		t.Error("Unsigned Int8 to Int16 flagged")
+	}
+
+	var row scSensor
+	var reading *int16
+	if e = (&gorbScanner{ptr: &row.Flags}).Scan(int64(255)); e != nil || row.Flags != 255 {
+		t.Error(e, row.Flags)
+	}
+	if (&gorbScanner{ptr: &row.Flags}).Scan(int64(256)) == nil {
+		t.Error("uint8 overflow accepted")
+	}
+	if (&gorbScanner{ptr: &row.Port}).Scan(int64(-1)) == nil {
+		t.Error("negative uint16 accepted")
+	}
+	if e = (&gorbScanner{ptr: &reading}).Scan([]byte("-32768")); e != nil || *reading != -32768 {
+		t.Error(e)
+	}
+	if (&gorbScanner{ptr: &row.Level}).Scan("128") == nil {
+		t.Error("int8 overflow accepted")
+	}
+}
+
+func TestWriteDDL(t *testing.T) {
+	var m GorbManager
+	for name, class := range map[string]reflect.Type{"sc_ticket": reflect.TypeOf(scTicket{}), "sc_order": reflect.TypeOf(scOrder{})} {
+		if _, e := m.RegisterEntity(class, name); e != nil {
+			t.Fatal(e)
+		}
+	}
+	su := &SchemaUpgrader{SqlDmlDriver: &SqliteSchemaUpgrader{}, ForeignKeys: true}
+	var buf bytes.Buffer
+	if e := su.WriteDDL(&buf, &m); e != nil {
+		t.Fatal(e)
+	}
+	ddl := buf.String()
+	var last int = -1
+	for _, table := range []string{"sc_order", "sc_line", "sc_ticket", "sc_ticket_note"} {
+		pos := strings.Index(ddl, "CREATE TABLE "+table+" (")
+		if pos <= last {
+			t.Fatalf("%s out of order:\n%s", table, ddl)
+		}
+		last = pos
+	}
+	if !strings.Contains(ddl, "CREATE INDEX SC_LINE_ORDER_ID_IDX ON sc_line (order_id);\n") {
+		t.Error(ddl)
+	}
+
+	tables := sortTablesByDependency([]*TableSchema{
+		{Name: "child", ForeignKeys: []*ForeignKeySchema{{RefTable: "parent"}}},
+		{Name: "parent"},
+	})
+	if tables[0].Name != "parent" || tables[1].Name != "child" {
+		t.Error("referenced table not first")
+	}
+}
+
+func TestStructGenerator(t *testing.T) {
+	drv := newFakeSchemaDriver()
+	orderId := &ColumnSchema{Name: "id", Type: Int64}
+	drv.CreateTable(&TableSchema{
+		Name:       "orders",
+		PrimaryKey: orderId,
+		Columns:    []*ColumnSchema{orderId, {Name: "customer", Type: String, Precision: 40}, {Name: "placed_at", Type: DateTime, IsNull: true}},
+		Indice:     []*IndexSchema{{Name: "ORDERS_CUSTOMER_IDX", Columns: []*ColumnSchema{{Name: "customer"}}, IsUnique: true}},
+	})
+	lineId, fkCol := &ColumnSchema{Name: "id", Type: Int64}, &ColumnSchema{Name: "order_id", Type: Int64}
+	drv.CreateTable(&TableSchema{
+		Name:        "order_line",
+		PrimaryKey:  lineId,
+		Columns:     []*ColumnSchema{lineId, fkCol, {Name: "qty", Type: Int32, HasDefault: true, Default: "1"}},
+		ForeignKeys: []*ForeignKeySchema{{Columns: []*ColumnSchema{fkCol}, RefTable: "orders", RefColumns: []string{"id"}, OnDeleteCascade: true}},
+	})
+
+	g := &StructGenerator{Driver: drv, Package: "model", Children: []*ChildMapping{{Parent: "orders", Child: "order_line"}}}
+	var buf bytes.Buffer
+	if e := g.Generate(&buf); e != nil {
+		t.Fatal(e)
+	}
+	src := buf.String()
+	for _, expected := range []string{
+		"package model",
+		"import \"time\"",
+		"Customer  string       `gorb:\"customer,:40,unique\"`",
+		"PlacedAt  *time.Time   `gorb:\"placed_at,null\"`",
+		"OrderLine []*OrderLine `gorb:\"order_line\"`",
+		"OrderId int64 `gorb:\"order_id,fk=cascade\"`",
+		"Qty     int32 `gorb:\"qty,default=1\"`",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("%s not found in\n%s", expected, src)
+		}
+	}
+
+	// the package itself is not imported
+	drv.CreateTable(&TableSchema{Name: "price", Columns: []*ColumnSchema{{Name: "amount", Type: Decimal, Precision: 12, Scale: 2}}})
+	g = &StructGenerator{Driver: drv, Package: "gorb"}
+	buf.Reset()
+	if e := g.Generate(&buf, "price"); e != nil || !strings.Contains(buf.String(), "Amount Fixed `gorb:\"amount,:12.2\"`") ||
+		strings.Contains(buf.String(), "import") {
+		t.Error(e, buf.String())
+	}
+
+	// composite keys are mapped only for child tables
+	sku := &ColumnSchema{Name: "sku", Type: String, Precision: 20}
+	drv.CreateTable(&TableSchema{Name: "stock", PrimaryKey: lineId, KeyColumns: []*ColumnSchema{lineId, sku}, Columns: []*ColumnSchema{lineId, sku}})
+	if e := g.Generate(&buf, "stock"); e == nil {
+		t.Error("composite key generated for root table")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ent := registerScOrder(t)
+	var m GorbManager
+	m.Entities = map[reflect.Type]*Entity{ent.RowClass: ent}
+
+	drv := newFakeSchemaDriver()
+	drv.CreateTable(&TableSchema{
+		Name: "sc_order",
+		Columns: []*ColumnSchema{{Name: "id", Type: Int64},
+			{Name: "customer", Type: String, Precision: 20, HasDefault: true},
+			{Name: "note", Type: Int32, IsNull: true}},
+	})
+	m.SchemaValidator = &SchemaUpgrader{SqlDmlDriver: drv}
+
+	e := m.SetDB(nil)
+	report, ok := e.(*SchemaReport)
+	if !ok {
+		t.Fatal("schema report expected", e)
+	}
+	var types []string
+	for _, d := range report.Drifts {
+		types = append(types, d.Type.String())
+	}
+	if strings.Join(types, ",") != "ColumnMismatch,ColumnMismatch,MissingIndex,MissingTable" {
+		t.Error(types)
+	}
+	if report.Drifts[0].Message != "Column customer: length 20, expected 40" || report.Drifts[0].Actual.Precision != 20 {
+		t.Error(report.Drifts[0].Message)
+	}
+
+	su := &SchemaUpgrader{SqlDmlDriver: &fakeFailingDriver{fakeSchemaDriver: drv}}
+	if report, e = su.Validate(&m); e == nil || report != nil {
+		t.Error("read error reported as drift", report)
+	}
+
+	// tables are read through the connection passed to SetDB
+	db, e := sql.Open("gorb_sc", "")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer db.Close()
+	m.SchemaValidator = &SchemaUpgrader{SqlDmlDriver: &SqliteSchemaUpgrader{}}
+	if e = m.SetDB(db); e == nil || !strings.Contains(e.Error(), "sqlite_master") {
+		t.Error(e)
+	}
+}
+
+type scCustomer struct {
+	Id    int64  `gorb:"id,pk"`
+	Name  string `gorb:"full_name,:80,was=name"`
+	Email string `gorb:"email,:120,was=mail,was=e_mail"`
+}
+
+func TestPlanRename(t *testing.T) {
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(scCustomer{}), "sc_customer,was=customer")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if ent.TableName != "sc_customer" || m.LookupEntityType("sc_customer") == nil {
+		t.Fatal("table name not parsed", ent.TableName)
+	}
+
+	drv := newFakeSchemaDriver()
+	drv.CreateTable(&TableSchema{
+		Name:    "customer",
+		Columns: []*ColumnSchema{{Name: "id", Type: Int64}, {Name: "name", Type: String, Precision: 60}, {Name: "e_mail", Type: String, Precision: 120}},
+	})
+	su := &SchemaUpgrader{SqlDmlDriver: drv, DropUnmapped: true, AllowDataLoss: true}
+	plan, e := su.PlanEntity(ent)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var buf bytes.Buffer
+	plan.WriteScript(&buf)
+	expected := "-- sc_customer\nRENAME customer sc_customer;\nRENAME sc_customer.name full_name;\nRENAME sc_customer.e_mail email;\nMODIFY sc_customer.full_name;\n\n"
+	if buf.String() != expected {
+		t.Error(buf.String())
+	}
+	if orphans, _ := su.PlanOrphanedTables(&m, "customer", "sc_"); !orphans.IsEmpty() {
+		t.Error("table pending rename planned for drop")
+	}
+
+	// applied
+	drv.RenameTable("customer", "sc_customer")
+	drv.tables["sc_customer"] = su.GetSchemaForEntity(ent)
+	plan, _ = su.PlanEntity(ent)
+	if !plan.IsEmpty() {
+		t.Error("rename is not idempotent", plan.Operations())
+	}
+}
+
+// fakeLockingDriver counts lock calls, held simulates another process
+type fakeLockingDriver struct {
+	*fakeSchemaDriver
+	locks, unlocks int
+	held           bool
+}
+
+func (f *fakeLockingDriver) Lock(timeout time.Duration) error {
+	if f.held {
+		return fmt.Errorf("%w: held after %v", ErrMigrationLockTimeout, timeout)
+	}
+	f.locks++
+	return nil
+}
+func (f *fakeLockingDriver) Unlock() error {
+	f.unlocks++
+	return nil
+}
+
+func TestMigrationLock(t *testing.T) {
+	ent := registerScOrder(t)
+	drv := &fakeLockingDriver{fakeSchemaDriver: newFakeSchemaDriver()}
+	su := &SchemaUpgrader{SqlDmlDriver: drv}
+	su.RegisterMigrationSql(1, "first", "UPDATE a SET b = 1")
+
+	if e := su.Upgrade(ent); e != nil {
+		t.Fatal(e)
+	}
+	if drv.locks != 1 || drv.unlocks != 1 || su.lockDepth != 0 {
+		t.Error("nested upgrade steps should share the lock", drv.locks, drv.unlocks)
+	}
+
+	func() {
+		defer func() { recover() }()
+		su.withLock(func() error { panic("migration failed") })
+	}()
+	if drv.unlocks != 2 || su.lockDepth != 0 {
+		t.Error("lock kept after panic", drv.unlocks, su.lockDepth)
+	}
+
+	drv.held = true
+	e := su.Migrate()
+	if !errors.Is(e, ErrMigrationLockTimeout) {
+		t.Error("lock timeout expected", e)
+	}
+}
+
+type (
+	scShipment struct {
+		ID          int64  `gorb:",pk"`
+		TrackingURL string `gorb:",:200"`
+		ShippedAt   *time.Time
+		Weight      Fixed
+		Internal    string      `gorb:"-"`
+		Parcels     []*scParcel `gorb:""`
+		note        string
+	}
+	scParcel struct {
+		ID         int64 `gorb:",pk"`
+		ShipmentID int64 `gorb:",fk"`
+		Label      string
+	}
+)
+
+func TestNamingStrategy(t *testing.T) {
+	for name, expected := range map[string][2]string{
+		"OrderLineID": {"order_line_id", "orderLineID"},
+		"HTTPServer":  {"http_server", "httpServer"},
+		"Line2Total":  {"line2_total", "line2Total"},
+		"ID":          {"id", "id"},
+		"name":        {"name", "name"},
+	} {
+		if s := SnakeCase.SqlName(name); s != expected[0] {
+			t.Error(name, s)
+		}
+		if s := LowerCamel.SqlName(name); s != expected[1] {
+			t.Error(name, s)
+		}
+	}
+
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(scShipment{}), "")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if ent.TableName != "sc_shipment" || ent.PrimaryKey.SqlName != "id" || len(ent.Fields) != 2 || ent.Fields[1].SqlName != "tracking_url" {
+		t.Error(ent.TableName, ent.Fields)
+	}
+	parcels := ent.Children[0]
+	if parcels.TableName != "sc_parcel" || parcels.ParentKey.SqlName != "shipment_id" || len(parcels.Fields) != 2 {
+		t.Error(parcels.TableName, parcels.Fields)
+	}
+
+	m = GorbManager{NamingStrategy: LowerCamel, MapAllFields: true}
+	ent, e = m.RegisterEntity(reflect.TypeOf(scShipment{}), ",was=shipment")
+	if e != nil {
+		t.Fatal(e)
+	}
+	var names []string
+	for _, f := range ent.Fields {
+		names = append(names, f.SqlName)
+	}
+	if ent.TableName != "scShipment" || strings.Join(names, ",") != "id,trackingURL,shippedAt,weight" || !ent.Fields[2].IsNullable {
+		t.Error(ent.TableName, names)
+	}
+	if len(ent.Children[0].Fields) != 3 || ent.Children[0].Fields[2].SqlName != "label" {
+		t.Error(ent.Children[0].Fields)
+	}
+
+	// sql.Scanner structs are single columns
+	type scRemark struct {
+		Id   int64 `gorb:"id,pk"`
+		Note sql.NullString
+	}
+	ent, e = m.RegisterEntity(reflect.TypeOf(scRemark{}), "sc_remark")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if f := ent.FieldByName("Note"); f == nil || f.SqlName != "note" || f.DataType != String || !f.IsNullable || !f.IsValuer {
+		t.Error(ent.Fields)
+	}
+}
+
+type (
+	scAddress struct {
+		Street string `gorb:"street,:80"`
+		City   string `gorb:"city,:40,was=town"`
+	}
+	scParty struct {
+		Name    string    `gorb:"name,:40"`
+		Address scAddress `gorb:",prefix=addr_"`
+	}
+	scContract struct {
+		Id       int64     `gorb:"id,pk"`
+		Billing  scAddress `gorb:",prefix=bill_"`
+		Shipping scAddress `gorb:",prefix=ship_"`
+		Seller   scParty   `gorb:",prefix=seller_"`
+	}
+)
+
+func TestEmbeddedPrefix(t *testing.T) {
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(scContract{}), "sc_contract")
+	if e != nil {
+		t.Fatal(e)
+	}
+	var names []string
+	for _, f := range ent.Fields {
+		names = append(names, f.SqlName)
+	}
+	if strings.Join(names, ",") != "id,bill_street,bill_city,ship_street,ship_city,seller_name,seller_addr_street,seller_addr_city" {
+		t.Error(names)
+	}
+	c := &scContract{Seller: scParty{Address: scAddress{City: "Riga"}}}
+	if v := reflect.ValueOf(c).Elem().FieldByIndex(ent.Fields[7].ClassIdx).Interface(); v != "Riga" {
+		t.Error(ent.Fields[7].ClassIdx, v)
+	}
+	if was := ent.Fields[2].PreviousNames; len(was) != 1 || was[0] != "bill_town" || ent.Fields[7].PreviousNames[0] != "seller_addr_town" {
+		t.Error(was, ent.Fields[7].PreviousNames)
+	}
+
+	type scTwice struct {
+		Id       int64 `gorb:"id,pk"`
+		Billing  scAddress
+		Shipping scAddress
+	}
+	if _, e = m.RegisterEntity(reflect.TypeOf(scTwice{}), "sc_twice"); e == nil || !strings.Contains(e.Error(), "Billing.Street and Shipping.Street") {
+		t.Error(e)
+	}
+	type scBadPrefix struct {
+		Id      int64     `gorb:"id,pk"`
+		Billing scAddress `gorb:",index"`
+	}
+	if _, e = m.RegisterEntity(reflect.TypeOf(scBadPrefix{}), "sc_bad_prefix"); e == nil {
+		t.Error("index accepted on embedded struct")
+	}
+
+	type scPointerEmbed struct {
+		Id      int64 `gorb:"id,pk"`
+		Billing *scAddress
+	}
+	pt := &Table{RowClass: reflect.TypeOf(scPointerEmbed{})}
+	if name := pt.indexPathName([]int{1, 1}); name != "Billing.City" {
+		t.Error(name)
+	}
+}
+
+type (
+	scGroup struct {
+		Id   int64  `gorb:"id,pk"`
+		Name string `gorb:"name,:40"`
+	}
+	scMember struct {
+		Id      int64       `gorb:"id,pk"`
+		Login   string      `gorb:"login,:40"`
+		Groups  []*scGroup  `gorb:"sc_member_group,m2m"`
+		Friends []*scMember `gorb:"sc_member_friend,m2m=member_id:friend_id"`
+		RoleIds []int64     `gorb:"sc_member_role,m2m"`
+	}
+)
+
+func TestManyToMany(t *testing.T) {
+	var m GorbManager
+	if _, e := m.RegisterEntity(reflect.TypeOf(scMember{}), "sc_member"); e == nil {
+		t.Error("relation to unregistered entity accepted")
+	}
+	if _, e := m.RegisterEntity(reflect.TypeOf(scGroup{}), "sc_group"); e != nil {
+		t.Fatal(e)
+	}
+	ent, e := m.RegisterEntity(reflect.TypeOf(scMember{}), "sc_member")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(ent.Fields) != 2 || len(ent.Relations) != 3 {
+		t.Fatal(ent.Fields, ent.Relations)
+	}
+	groups, friends, roleIds := ent.Relations[0], ent.Relations[1], ent.Relations[2]
+	if groups.OwnerKey.SqlName != "sc_member_id" || groups.RelatedKey.SqlName != "sc_group_id" || groups.related.TableName != "sc_group" {
+		t.Error(groups.OwnerKey, groups.RelatedKey)
+	}
+	if friends.related != ent || friends.RelatedKey.SqlName != "friend_id" || roleIds.RelatedKey.SqlName != "role_id" || roleIds.RelatedKey.DataType != Int64 {
+		t.Error(friends.RelatedKey, roleIds.RelatedKey)
+	}
+
+	var pg PostgresDialect
+	if q := friends.getSelectQuery(pg); q != `SELECT "friend_id" FROM "sc_member_friend" WHERE "member_id" = $1` {
+		t.Error(q)
+	}
+	if q := friends.getInsertQuery(pg); q != `INSERT INTO "sc_member_friend"("member_id", "friend_id") VALUES ($1, $2)` {
+		t.Error(q)
+	}
+	if q := friends.getRemoveQuery(pg); q != `DELETE FROM "sc_member_friend" WHERE "member_id"=$1 AND "friend_id"=$2` {
+		t.Error(q)
+	}
+
+	member := &scMember{Groups: []*scGroup{{Id: 3}, nil, {Id: 5}}}
+	keys, e := groups.relatedKeys(reflect.ValueOf(member).Elem())
+	if e != nil || len(keys) != 2 || keys[1].id != 5 {
+		t.Error(e, keys)
+	}
+	member.Groups = append(member.Groups, &scGroup{Name: "new"})
+	if _, e = groups.relatedKeys(reflect.ValueOf(member).Elem()); e == nil {
+		t.Error("related entity without key accepted")
+	}
+
+	su := &SchemaUpgrader{SqlDmlDriver: &SqliteSchemaUpgrader{}, ForeignKeys: true}
+	var buf bytes.Buffer
+	if e = su.WriteDDL(&buf, &m); e != nil {
+		t.Fatal(e)
+	}
+	ddl := buf.String()
+	if strings.Count(ddl, "CREATE TABLE sc_member_group (") != 1 ||
+		!strings.Contains(ddl, "PRIMARY KEY(member_id, friend_id)") ||
+		!strings.Contains(ddl, "CONSTRAINT SC_MEMBER_GROUP_SC_GROUP_ID_FK FOREIGN KEY (sc_group_id) REFERENCES sc_group (id) ON DELETE CASCADE") {
+		t.Error(ddl)
+	}
+	if strings.Index(ddl, "CREATE TABLE sc_member_group (") < strings.Index(ddl, "CREATE TABLE sc_member (") {
+		t.Error("join table created before referenced tables\n", ddl)
+	}
+
+	type scSelfLink struct {
+		Id      int64         `gorb:"id,pk"`
+		Peers   []*scSelfLink `gorb:"sc_peer,m2m"`
+		PeerIds []int64       `gorb:"sc_peer,m2m"`
+	}
+	if _, e = m.RegisterEntity(reflect.TypeOf(scSelfLink{}), "sc_self_link"); e == nil || !strings.Contains(e.Error(), "both named sc_self_link_id") {
+		t.Error(e)
+	}
+
+	type scSharedLink struct {
+		Id       int64      `gorb:"id,pk"`
+		Groups   []*scGroup `gorb:"sc_shared_group,m2m"`
+		GroupIds []int64    `gorb:"sc_shared_group,m2m=sc_shared_link_id:sc_group_id"`
+	}
+	if _, e = m.RegisterEntity(reflect.TypeOf(scSharedLink{}), "sc_shared_link"); e == nil || !strings.Contains(e.Error(), "declared twice") {
+		t.Error(e)
+	}
+}
+
+type (
+	scClient struct {
+		Id        int64     `gorb:"id,pk"`
+		Name      string    `gorb:"name,:40"`
+		ManagerId *int64    `gorb:"manager_id,ref=sc_client,load=Manager"`
+		Manager   *scClient `gorb:"-"`
+	}
+	scInvoice struct {
+		Id       int64 `gorb:"id,pk"`
+		ClientId int64 `gorb:"client_id,ref=sc_client,load=Client"`
+		Client   *scClient
+		Lines    []*scInvoiceLine `gorb:"sc_invoice_line"`
+	}
+	scInvoiceLine struct {
+		Id        int64 `gorb:"id,pk"`
+		InvoiceId int64 `gorb:"invoice_id,fk=cascade"`
+		PayerId   int64 `gorb:"payer_id,ref=sc_client"`
+	}
+)
+
+func TestReferences(t *testing.T) {
+	var m GorbManager
+	if _, e := m.RegisterEntity(reflect.TypeOf(scInvoice{}), "sc_invoice"); e == nil {
+		t.Error("reference to unregistered entity accepted")
+	}
+	client, e := m.RegisterEntity(reflect.TypeOf(scClient{}), "sc_client")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if ref := client.FieldByName("ManagerId").Reference; ref.entity != client || len(ref.LoadIdx) != 1 || ref.LoadIdx[0] != 3 {
+		t.Error(ref)
+	}
+	invoice, e := m.RegisterEntity(reflect.TypeOf(scInvoice{}), "sc_invoice")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(invoice.Fields) != 2 || invoice.Fields[1].Reference.entity != client {
+		t.Fatal(invoice.Fields)
+	}
+
+	// zero key clears the load field, no database access
+	inv := &scInvoice{Client: &scClient{Id: 5}, Lines: []*scInvoiceLine{{Id: 1}}}
+	if e = invoice.populateReferences(reflect.ValueOf(inv).Elem()); e != nil || inv.Client != nil {
+		t.Error(e, inv.Client)
+	}
+
+	su := &SchemaUpgrader{SqlDmlDriver: &SqliteSchemaUpgrader{}, ForeignKeys: true}
+	var buf bytes.Buffer
+	if e = su.WriteDDL(&buf, &m); e != nil {
+		t.Fatal(e)
+	}
+	ddl := buf.String()
+	for _, fk := range []string{
+		"CONSTRAINT SC_CLIENT_MANAGER_ID_FK FOREIGN KEY (manager_id) REFERENCES sc_client (id)",
+		"CONSTRAINT SC_INVOICE_CLIENT_ID_FK FOREIGN KEY (client_id) REFERENCES sc_client (id)",
+		"CONSTRAINT SC_INVOICE_LINE_PAYER_ID_FK FOREIGN KEY (payer_id) REFERENCES sc_client (id)",
+	} {
+		if !strings.Contains(ddl, fk) {
+			t.Error(fk, ddl)
+		}
+	}
+	if strings.Contains(ddl, "REFERENCES sc_client (id) ON DELETE") {
+		t.Error("cascading reference\n", ddl)
+	}
+	if strings.Index(ddl, "CREATE TABLE sc_client (") > strings.Index(ddl, "CREATE TABLE sc_invoice (") {
+		t.Error("referenced table created later\n", ddl)
+	}
+
+	type scBadLoad struct {
+		Id       int64    `gorb:"id,pk"`
+		ClientId int64    `gorb:"client_id,ref=sc_client,load=Client"`
+		Client   scClient `gorb:"-"`
+	}
+	if _, e = m.RegisterEntity(reflect.TypeOf(scBadLoad{}), "sc_bad_load"); e == nil {
+		t.Error("load field of wrong type accepted")
+	}
+}
@@ -0,0 +1,192 @@
+package gorb
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type SchemaDriftType uint32
+
+const (
+	DriftMissingTable SchemaDriftType = iota
+	DriftMissingColumn
+	DriftColumnMismatch
+	DriftMissingIndex
+	DriftIndexMismatch
+	DriftMissingForeignKey
+)
+
+type (
+	// SchemaDrift is a difference between a mapped table and the database.
+	// Expected is the column as declared by the entity, Actual as read from the database.
+	SchemaDrift struct {
+		Type       SchemaDriftType
+		Table      string
+		Expected   *ColumnSchema
+		Actual     *ColumnSchema
+		Index      *IndexSchema
+		ForeignKey *ForeignKeySchema
+		Message    string
+	}
+
+	// SchemaReport is the result of SchemaUpgrader.Validate.
+	// It implements error, so it can be returned as is when the schema is not valid.
+	SchemaReport struct {
+		Drifts []*SchemaDrift
+	}
+
+	// connectedDriver is implemented by schema drivers reading the database through *sql.DB
+	connectedDriver interface {
+		forDB(db *sql.DB) DbSchemaUpgrader
+	}
+)
+
+func (t SchemaDriftType) String() string {
+	switch t {
+	case DriftMissingTable:
+		return "MissingTable"
+	case DriftMissingColumn:
+		return "MissingColumn"
+	case DriftColumnMismatch:
+		return "ColumnMismatch"
+	case DriftMissingIndex:
+		return "MissingIndex"
+	case DriftIndexMismatch:
+		return "IndexMismatch"
+	case DriftMissingForeignKey:
+		return "MissingForeignKey"
+	}
+	return fmt.Sprintf("SchemaDriftType(%d)", uint32(t))
+}
+
+// IsValid reports whether no drift has been found
+func (r *SchemaReport) IsValid() bool {
+	return len(r.Drifts) == 0
+}
+
+func (r *SchemaReport) Error() string {
+	var lines []string = make([]string, len(r.Drifts))
+	for i, d := range r.Drifts {
+		lines[i] = fmt.Sprintf("%s %s: %s", d.Type, d.Table, d.Message)
+	}
+	return fmt.Sprintf("Database schema does not match %d mapped table(s):\n%s", len(r.Drifts), strings.Join(lines, "\n"))
+}
+
+func (r *SchemaReport) add(drift *SchemaDrift) {
+	r.Drifts = append(r.Drifts, drift)
+}
+
+// columnDrift describes type, length and nullability differences, defaults are not compared
+func columnDrift(classColumn, dbColumn *ColumnSchema) string {
+	var diffs []string = make([]string, 0, 2)
+	if dbColumn.Type != Unsupported && !(classColumn.Type == Float && dbColumn.Type == Decimal) {
+		if classColumn.Type != dbColumn.Type || (isIntegerType(classColumn.Type) && classColumn.IsUnsigned != dbColumn.IsUnsigned) {
+			diffs = append(diffs, fmt.Sprintf("type %s, expected %s", integerTypeName(dbColumn), integerTypeName(classColumn)))
+		} else if classColumn.Type == String && classColumn.Precision != dbColumn.Precision {
+			diffs = append(diffs, fmt.Sprintf("length %d, expected %d", dbColumn.Precision, classColumn.Precision))
+		} else if classColumn.Type == Decimal && (classColumn.Precision != dbColumn.Precision || classColumn.Scale != dbColumn.Scale) {
+			diffs = append(diffs, fmt.Sprintf("decimal(%d,%d), expected decimal(%d,%d)", dbColumn.Precision, dbColumn.Scale, classColumn.Precision, classColumn.Scale))
+		}
+	}
+	if classColumn.IsNull != dbColumn.IsNull {
+		if dbColumn.IsNull {
+			diffs = append(diffs, "NULL, expected NOT NULL")
+		} else {
+			diffs = append(diffs, "NOT NULL, expected NULL")
+		}
+	}
+	return strings.Join(diffs, ", ")
+}
+
+// validateTable adds drifts of the table to report, tableNames are read by ReadTableNames
+func (su *SchemaUpgrader) validateTable(report *SchemaReport, classSchema *TableSchema, tableNames []string) error {
+	if !containsTable(tableNames, classSchema.Name) {
+		report.add(&SchemaDrift{Type: DriftMissingTable, Table: classSchema.Name,
+			Message: fmt.Sprintf("Table %s does not exist", classSchema.Name)})
+		return nil
+	}
+	dbSchema, e := su.SqlDmlDriver.ReadTableSchema(classSchema.Name)
+	if e != nil {
+		return e
+	}
+
+	for _, fsc := range classSchema.Columns {
+		fsdb := dbSchema.ColumnByName(fsc.Name)
+		if fsdb == nil {
+			report.add(&SchemaDrift{Type: DriftMissingColumn, Table: classSchema.Name, Expected: fsc,
+				Message: fmt.Sprintf("Column %s does not exist", fsc.Name)})
+			continue
+		}
+		if fsc == classSchema.PrimaryKey {
+			// serial keys are read back with database specific types
+			continue
+		}
+		if diff := columnDrift(fsc, fsdb); len(diff) > 0 {
+			report.add(&SchemaDrift{Type: DriftColumnMismatch, Table: classSchema.Name, Expected: fsc, Actual: fsdb,
+				Message: fmt.Sprintf("Column %s: %s", fsc.Name, diff)})
+		}
+	}
+
+	for _, isc := range classSchema.Indice {
+		isdb := dbSchema.IndexLike(isc)
+		if isdb == nil {
+			report.add(&SchemaDrift{Type: DriftMissingIndex, Table: classSchema.Name, Index: isc,
+				Message: fmt.Sprintf("Index on %s does not exist", strings.Join(isc.ColumnNames(), ", "))})
+		} else if isdb.IsUnique != isc.IsUnique {
+			report.add(&SchemaDrift{Type: DriftIndexMismatch, Table: classSchema.Name, Index: isc,
+				Message: fmt.Sprintf("Index %s: unique %t, expected %t", isdb.Name, isdb.IsUnique, isc.IsUnique)})
+		}
+	}
+
+	for _, fksc := range classSchema.ForeignKeys {
+		if dbSchema.ForeignKeyLike(fksc) == nil {
+			report.add(&SchemaDrift{Type: DriftMissingForeignKey, Table: classSchema.Name, ForeignKey: fksc,
+				Message: fmt.Sprintf("Foreign key on %s does not exist", strings.Join(fksc.ColumnNames(), ", "))})
+		}
+	}
+	return nil
+}
+
+// Validate compares all entities registered in mgr, their child tables and join tables with the database schema.
+// Nothing is changed. Drifts are reported for missing tables, columns, indexes and
+// foreign keys (if ForeignKeys is set) and for columns with different type, length or nullability.
+// Errors reading the database schema are returned instead of the report.
+func (su *SchemaUpgrader) Validate(mgr *GorbManager) (*SchemaReport, error) {
+	if su.SqlDmlDriver == nil {
+		return nil, fmt.Errorf("Schema driver is not set")
+	}
+	var entities []*Entity = make([]*Entity, 0, len(mgr.Entities))
+	for _, ent := range mgr.Entities {
+		entities = append(entities, ent)
+	}
+	sort.Slice(entities, func(i, j int) bool {
+		return entities[i].TableName < entities[j].TableName
+	})
+
+	names, e := su.SqlDmlDriver.ReadTableNames()
+	if e != nil {
+		return nil, e
+	}
+	var report *SchemaReport = new(SchemaReport)
+	report.Drifts = make([]*SchemaDrift, 0, 4)
+	for _, ent := range entities {
+		for _, ts := range su.getEntitySchemas(ent) {
+			e = su.validateTable(report, ts, names)
+			if e != nil {
+				return nil, fmt.Errorf("Table %s: %v", ts.Name, e)
+			}
+		}
+	}
+	return report, nil
+}
+
+// validateDB validates the schema of db, SqlDmlDriver may be connected to another database
+func (su *SchemaUpgrader) validateDB(mgr *GorbManager, db *sql.DB) (*SchemaReport, error) {
+	var validator SchemaUpgrader = *su
+	if driver, ok := su.SqlDmlDriver.(connectedDriver); ok {
+		validator.SqlDmlDriver = driver.forDB(db)
+	}
+	return validator.Validate(mgr)
+}
@@ -0,0 +1,67 @@
+package gorb
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SchemaVersionTable keeps the version of the last applied migration.
+// The table is created by SetVersion, GetVersion returns 0 while it does not exist.
+const SchemaVersionTable string = "gorb_schema_version"
+
+func ensureVersionTable(db *sql.DB) error {
+	_, e := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version INTEGER NOT NULL)", SchemaVersionTable))
+	return e
+}
+
+func schemaVersionQuery(version int32) string {
+	return fmt.Sprintf("INSERT INTO %s (version) VALUES (%d)", SchemaVersionTable, version)
+}
+
+// containsTable reports whether names read by ReadTableNames contain the table
+func containsTable(names []string, tableName string) bool {
+	for _, name := range names {
+		if strings.EqualFold(name, tableName) {
+			return true
+		}
+	}
+	return false
+}
+
+// readSchemaVersion reads the version without creating the table, tableNames are read by ReadTableNames
+func readSchemaVersion(db *sql.DB, tableNames []string) (int32, error) {
+	if !containsTable(tableNames, SchemaVersionTable) {
+		return 0, nil
+	}
+	var version sql.NullInt64
+	e := db.QueryRow(fmt.Sprintf("SELECT MAX(version) FROM %s", SchemaVersionTable)).Scan(&version)
+	if e != nil {
+		return -1, e
+	}
+	if !version.Valid {
+		return 0, nil
+	}
+	return int32(version.Int64), nil
+}
+
+func writeSchemaVersion(db *sql.DB, version int32) error {
+	e := ensureVersionTable(db)
+	if e != nil {
+		return e
+	}
+	txn, e := db.Begin()
+	if e != nil {
+		return e
+	}
+	_, e = txn.Exec(fmt.Sprintf("DELETE FROM %s", SchemaVersionTable))
+	if e == nil {
+		_, e = txn.Exec(schemaVersionQuery(version))
+	}
+	if e == nil {
+		e = txn.Commit()
+	} else {
+		txn.Rollback()
+	}
+	return e
+}
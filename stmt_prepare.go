@@ -13,6 +13,8 @@ type (
 		stmtUpdate *sql.Stmt
 		stmtRemove *sql.Stmt
 		stmtDelete *sql.Stmt
+
+		isInsertReturning bool
 	}
 )
 
@@ -43,40 +45,39 @@ func (stmts *tableStmts) releaseStatements() {
 	}
 }
 
-func (c *ChildTable) createStatements(db *sql.DB, tablePath []*ChildTable) error {
+func (c *ChildTable) createStatements(db *sql.DB, d Dialect, tablePath []*ChildTable) error {
 	stmts := new(tableStmts)
+	stmts.isInsertReturning = !d.HasLastInsertId()
 	var e error = nil
 	var query string
 
 	if e == nil {
-		query = c.getInfoQuery(tablePath)
+		query = c.getInfoQuery(d, tablePath)
 		stmts.stmtInfo, e = db.Prepare(query)
 	}
 	if e == nil {
-		query = c.getSelectQuery(tablePath)
+		query = c.getSelectQuery(d, tablePath)
 		stmts.stmtSelect, e = db.Prepare(query)
 	}
 	if e == nil {
-		query = c.getInsertQuery()
-		fmt.Println(query)
+		query = c.getInsertQuery(d)
 		stmts.stmtInsert, e = db.Prepare(query)
 	}
 	if e == nil {
-		query = c.getUpdateQuery()
+		query = c.getUpdateQuery(d)
 		stmts.stmtUpdate, e = db.Prepare(query)
 	}
 	if e == nil {
-		query = c.getRemoveQuery()
+		query = c.getRemoveQuery(d)
 		stmts.stmtRemove, e = db.Prepare(query)
 	}
 	if e == nil {
-		query = c.getDeleteQuery(tablePath)
+		query = c.getDeleteQuery(d, tablePath)
 		stmts.stmtDelete, e = db.Prepare(query)
 	}
 	if e != nil {
-		fmt.Printf("Invalid query: %s", query)
 		stmts.releaseStatements()
-		return e
+		return fmt.Errorf("Invalid query %s: %v", query, e)
 	}
 
 	if c.stmts != nil {
@@ -86,7 +87,7 @@ func (c *ChildTable) createStatements(db *sql.DB, tablePath []*ChildTable) error
 	c.stmts = stmts
 
 	for _, child := range c.Children {
-		e = child.createStatements(db, append(tablePath, c))
+		e = child.createStatements(db, d, append(tablePath, c))
 		if e != nil {
 			return e
 		}
@@ -94,41 +95,41 @@ func (c *ChildTable) createStatements(db *sql.DB, tablePath []*ChildTable) error
 	return nil
 }
 
-func (entity *Entity) createStatements(db *sql.DB) error {
+func (entity *Entity) createStatements(db *sql.DB, d Dialect) error {
 	stmts := new(tableStmts)
+	stmts.isInsertReturning = !d.HasLastInsertId()
 	var e error = nil
 	var query string
 
-	entity.selectFields = entity.getSelectFields()
+	entity.selectFields = entity.getSelectFields(d)
 
 	if e == nil {
-		query = entity.getInfoQuery()
+		query = entity.getInfoQuery(d)
 		stmts.stmtInfo, e = db.Prepare(query)
 	}
 	if e == nil {
-		query = entity.getSelectQuery()
+		query = entity.getSelectQuery(d)
 		stmts.stmtSelect, e = db.Prepare(query)
 	}
 	if e == nil {
-		query = entity.getInsertQuery()
+		query = entity.getInsertQuery(d)
 		stmts.stmtInsert, e = db.Prepare(query)
 	}
 	if e == nil {
-		query = entity.getUpdateQuery()
+		query = entity.getUpdateQuery(d)
 		stmts.stmtUpdate, e = db.Prepare(query)
 	}
 	if e == nil {
-		query = entity.getRemoveQuery()
+		query = entity.getRemoveQuery(d)
 		stmts.stmtRemove, e = db.Prepare(query)
 	}
 	if e == nil {
-		query = entity.getDeleteQuery()
+		query = entity.getDeleteQuery(d)
 		stmts.stmtDelete, e = db.Prepare(query)
 	}
 	if e != nil {
-		fmt.Printf("Invalid query: %s", query)
 		stmts.releaseStatements()
-		return e
+		return fmt.Errorf("Invalid query %s: %v", query, e)
 	}
 
 	if entity.stmts != nil {
@@ -138,10 +139,49 @@ func (entity *Entity) createStatements(db *sql.DB) error {
 	entity.stmts = stmts
 
 	for _, child := range entity.Children {
-		e = child.createStatements(db, []*ChildTable{})
+		e = child.createStatements(db, d, []*ChildTable{})
+		if e != nil {
+			return e
+		}
+	}
+	for _, rel := range entity.Relations {
+		e = rel.createStatements(db, d)
 		if e != nil {
 			return e
 		}
 	}
 	return nil
 }
+
+func (rel *ManyToMany) createStatements(db *sql.DB, d Dialect) error {
+	stmts := new(tableStmts)
+	var e error = nil
+	var query string
+
+	if e == nil {
+		query = rel.getSelectQuery(d)
+		stmts.stmtSelect, e = db.Prepare(query)
+	}
+	if e == nil {
+		query = rel.getInsertQuery(d)
+		stmts.stmtInsert, e = db.Prepare(query)
+	}
+	if e == nil {
+		query = rel.getRemoveQuery(d)
+		stmts.stmtRemove, e = db.Prepare(query)
+	}
+	if e == nil {
+		query = rel.getDeleteQuery(d)
+		stmts.stmtDelete, e = db.Prepare(query)
+	}
+	if e != nil {
+		stmts.releaseStatements()
+		return fmt.Errorf("Invalid query %s: %v", query, e)
+	}
+
+	if rel.stmts != nil {
+		rel.stmts.releaseStatements()
+	}
+	rel.stmts = stmts
+	return nil
+}
@@ -3,42 +3,64 @@ package gorb
 import (
 	"bytes"
 	"fmt"
+	"strings"
 )
 
-func (c *ChildTable) getInfoQuery(tablePath []*ChildTable) string {
+// keyColumns renders key columns with optional table alias prefix
+func (t *Table) keyColumns(d Dialect, prefix string) string {
+	var columns []string = make([]string, len(t.KeyFields))
+	for i, kf := range t.KeyFields {
+		columns[i] = prefix + d.QuoteIdentifier(kf.SqlName)
+	}
+	return strings.Join(columns, ", ")
+}
+
+// keyCondition renders WHERE condition on key columns with placeholders numbered from firstParam
+func (t *Table) keyCondition(d Dialect, firstParam int) string {
+	var conditions []string = make([]string, len(t.KeyFields))
+	for i, kf := range t.KeyFields {
+		conditions[i] = d.QuoteIdentifier(kf.SqlName) + "=" + d.Placeholder(firstParam+i)
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+func (c *ChildTable) getInfoQuery(d Dialect, tablePath []*ChildTable) string {
+	q := d.QuoteIdentifier
 	if len(tablePath) == 0 {
-		return fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", c.PrimaryKey.SqlName, c.TableName, c.ParentKey.SqlName)
+		return fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s", c.keyColumns(d, ""), q(c.TableName), q(c.ParentKey.SqlName), d.Placeholder(1))
 	}
 
 	var buffer bytes.Buffer
-	buffer.WriteString(fmt.Sprintf("SELECT t%d.%s FROM %s t%d", c.tableNo, c.PrimaryKey.SqlName, c.TableName, c.tableNo))
+	buffer.WriteString(fmt.Sprintf("SELECT %s FROM %s t%d", c.keyColumns(d, fmt.Sprintf("t%d.", c.tableNo)), q(c.TableName), c.tableNo))
 
 	fullPath := append(tablePath, c)
 	for i := len(fullPath) - 2; i >= 0; i-- {
 		t1 := fullPath[i]
 		t2 := fullPath[i+1]
-		buffer.WriteString(fmt.Sprintf(" INNER JOIN %s t%d ON t%d.%s = t%d.%s", t1.TableName, t1.tableNo, t1.tableNo, t1.PrimaryKey.SqlName, t2.tableNo, t2.ParentKey.SqlName))
+		buffer.WriteString(fmt.Sprintf(" INNER JOIN %s t%d ON t%d.%s = t%d.%s", q(t1.TableName), t1.tableNo, t1.tableNo, q(t1.PrimaryKey.SqlName), t2.tableNo, q(t2.ParentKey.SqlName)))
 	}
 
-	buffer.WriteString(fmt.Sprintf(" WHERE t%d.%s = ?", tablePath[0].tableNo, tablePath[0].ParentKey.SqlName))
+	buffer.WriteString(fmt.Sprintf(" WHERE t%d.%s = %s", tablePath[0].tableNo, q(tablePath[0].ParentKey.SqlName), d.Placeholder(1)))
 
 	return buffer.String()
 }
 
-func (e *Entity) getInfoQuery() string {
+func (e *Entity) getInfoQuery(d Dialect) string {
+	q := d.QuoteIdentifier
 	var buffer bytes.Buffer
-	buffer.WriteString(fmt.Sprintf("SELECT %s", e.PrimaryKey.SqlName))
+	buffer.WriteString(fmt.Sprintf("SELECT %s", q(e.PrimaryKey.SqlName)))
 	if e.TokenField != nil {
-		buffer.WriteString(fmt.Sprintf(", %s", e.TokenField.SqlName))
+		buffer.WriteString(fmt.Sprintf(", %s", q(e.TokenField.SqlName)))
 	} else {
 		buffer.WriteString(", 0")
 	}
-	buffer.WriteString(fmt.Sprintf(" FROM %s WHERE %s = ?", e.TableName, e.PrimaryKey.SqlName))
+	buffer.WriteString(fmt.Sprintf(" FROM %s WHERE %s = %s", q(e.TableName), q(e.PrimaryKey.SqlName), d.Placeholder(1)))
 
 	return buffer.String()
 }
 
-func (c *ChildTable) getSelectQuery(tablePath []*ChildTable) string {
+func (c *ChildTable) getSelectQuery(d Dialect, tablePath []*ChildTable) string {
+	q := d.QuoteIdentifier
 	var buffer bytes.Buffer
 
 	buffer.WriteString("SELECT ")
@@ -46,26 +68,26 @@ func (c *ChildTable) getSelectQuery(tablePath []*ChildTable) string {
 		if i > 0 {
 			buffer.WriteString(", ")
 		}
-		buffer.WriteString(fmt.Sprintf("t%d.%s", c.tableNo, f.SqlName))
+		buffer.WriteString(fmt.Sprintf("t%d.%s", c.tableNo, q(f.SqlName)))
 	}
 
-	buffer.WriteString(fmt.Sprintf(" FROM %s t%d ", c.TableName, c.tableNo))
+	buffer.WriteString(fmt.Sprintf(" FROM %s t%d ", q(c.TableName), c.tableNo))
 	if len(tablePath) > 1 {
 		fullPath := append(tablePath, c)
 		for i := len(fullPath) - 2; i >= 1; i-- {
 			t1 := fullPath[i]
 			t2 := fullPath[i+1]
-			buffer.WriteString(fmt.Sprintf(" INNER JOIN %s t%d ON t%d.%s = t%d.%s", t1.TableName, t1.tableNo, t1.tableNo, t1.PrimaryKey.SqlName, t2.tableNo, t2.ParentKey.SqlName))
+			buffer.WriteString(fmt.Sprintf(" INNER JOIN %s t%d ON t%d.%s = t%d.%s", q(t1.TableName), t1.tableNo, t1.tableNo, q(t1.PrimaryKey.SqlName), t2.tableNo, q(t2.ParentKey.SqlName)))
 		}
-		buffer.WriteString(fmt.Sprintf(" WHERE t%d.%s = ?", tablePath[1].tableNo, tablePath[1].ParentKey.SqlName))
+		buffer.WriteString(fmt.Sprintf(" WHERE t%d.%s = %s", tablePath[1].tableNo, q(tablePath[1].ParentKey.SqlName), d.Placeholder(1)))
 	} else {
-		buffer.WriteString(fmt.Sprintf(" WHERE t%d.%s = ?", c.tableNo, c.ParentKey.SqlName))
+		buffer.WriteString(fmt.Sprintf(" WHERE t%d.%s = %s", c.tableNo, q(c.ParentKey.SqlName), d.Placeholder(1)))
 	}
 
 	return buffer.String()
 }
 
-func (e *Entity) getSelectFields() string {
+func (e *Entity) getSelectFields(d Dialect) string {
 	var buffer bytes.Buffer
 
 	buffer.WriteString("SELECT ")
@@ -73,48 +95,41 @@ func (e *Entity) getSelectFields() string {
 		if i > 0 {
 			buffer.WriteString(", ")
 		}
-		buffer.WriteString(f.SqlName)
+		buffer.WriteString(d.QuoteIdentifier(f.SqlName))
 	}
 
-	buffer.WriteString(fmt.Sprintf(" FROM %s", e.TableName))
+	buffer.WriteString(fmt.Sprintf(" FROM %s", d.QuoteIdentifier(e.TableName)))
 
 	return buffer.String()
 }
 
-func (e *Entity) getSelectQuery() string {
+func (e *Entity) getSelectQuery(d Dialect) string {
 	var buffer bytes.Buffer
 
-	buffer.WriteString("SELECT ")
-	for i, f := range e.Fields {
-		if i > 0 {
-			buffer.WriteString(", ")
-		}
-		buffer.WriteString(f.SqlName)
-	}
-
-	buffer.WriteString(fmt.Sprintf(" FROM %s WHERE %s = ?", e.TableName, e.PrimaryKey.SqlName))
+	buffer.WriteString(e.getSelectFields(d))
+	buffer.WriteString(fmt.Sprintf(" WHERE %s = %s", d.QuoteIdentifier(e.PrimaryKey.SqlName), d.Placeholder(1)))
 
 	return buffer.String()
 }
 
-func (c *ChildTable) getInsertQuery() string {
+func (t *Table) getInsertQuery(d Dialect) string {
 	var buffer bytes.Buffer
 
 	buffer.WriteString("INSERT INTO ")
-	buffer.WriteString(c.TableName)
+	buffer.WriteString(d.QuoteIdentifier(t.TableName))
 	buffer.WriteString("(")
 
 	i := 0
-	if !c.IsPkSerial { // put PK first
-		buffer.WriteString(c.PrimaryKey.SqlName)
-		i++
+	if !t.IsPkSerial { // put PK first
+		buffer.WriteString(t.keyColumns(d, ""))
+		i += len(t.KeyFields)
 	}
-	for _, f := range c.Fields {
-		if f != c.PrimaryKey {
+	for _, f := range t.Fields {
+		if !t.isKeyField(f) {
 			if i > 0 {
 				buffer.WriteString(", ")
 			}
-			buffer.WriteString(f.SqlName)
+			buffer.WriteString(d.QuoteIdentifier(f.SqlName))
 			i++
 		}
 	}
@@ -123,91 +138,62 @@ func (c *ChildTable) getInsertQuery() string {
 		if j > 0 {
 			buffer.WriteString(", ")
 		}
-		buffer.WriteString("?")
+		buffer.WriteString(d.Placeholder(j + 1))
 	}
 	buffer.WriteString(")")
-
-	return buffer.String()
-}
-
-func (e *Entity) getInsertQuery() string {
-	var buffer bytes.Buffer
-
-	buffer.WriteString("INSERT INTO ")
-	buffer.WriteString(e.TableName)
-	buffer.WriteString("(")
-
-	i := 0
-	if !e.IsPkSerial { // put PK first
-		buffer.WriteString(e.PrimaryKey.SqlName)
-		i++
-	}
-	for _, f := range e.Fields {
-		if f != e.PrimaryKey {
-			if i > 0 {
-				buffer.WriteString(", ")
-			}
-			buffer.WriteString(f.SqlName)
-			i++
-		}
+	if t.IsPkSerial && !d.HasLastInsertId() {
+		buffer.WriteString(d.Returning(t.PrimaryKey.SqlName))
 	}
-	buffer.WriteString(") VALUES (")
-	for j := 0; j < i; j++ {
-		if j > 0 {
-			buffer.WriteString(", ")
-		}
-		buffer.WriteString("?")
-	}
-	buffer.WriteString(")")
 
 	return buffer.String()
 }
 
-func (t *Table) getUpdateQuery() string {
+func (t *Table) getUpdateQuery(d Dialect) string {
 	var buffer bytes.Buffer
 
 	buffer.WriteString("UPDATE ")
-	buffer.WriteString(t.TableName)
+	buffer.WriteString(d.QuoteIdentifier(t.TableName))
 	buffer.WriteString(" SET ")
 
 	i := 0
 	for _, f := range t.Fields {
-		if i > 0 {
-			buffer.WriteString(", ")
-		}
-		if f != t.PrimaryKey {
+		if !t.isKeyField(f) {
+			if i > 0 {
+				buffer.WriteString(", ")
+			}
 			i++
-			buffer.WriteString(f.SqlName)
-			buffer.WriteString("=?")
+			buffer.WriteString(d.QuoteIdentifier(f.SqlName))
+			buffer.WriteString("=")
+			buffer.WriteString(d.Placeholder(i))
 		}
 	}
 	buffer.WriteString(" WHERE ")
-	buffer.WriteString(t.PrimaryKey.SqlName)
-	buffer.WriteString("=?")
+	buffer.WriteString(t.keyCondition(d, i+1))
 
 	return buffer.String()
 }
 
-func (t *Table) getRemoveQuery() string {
-	return fmt.Sprintf("DELETE FROM %s WHERE %s = ?", t.TableName, t.PrimaryKey.SqlName)
+func (t *Table) getRemoveQuery(d Dialect) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", d.QuoteIdentifier(t.TableName), t.keyCondition(d, 1))
 }
 
-func (c *ChildTable) getDeleteQuery(tablePath []*ChildTable) string {
+func (c *ChildTable) getDeleteQuery(d Dialect, tablePath []*ChildTable) string {
+	q := d.QuoteIdentifier
 	var buffer bytes.Buffer
 
 	if len(tablePath) == 0 {
-		buffer.WriteString(fmt.Sprintf("DELETE FROM %s WHERE %s = ?", c.TableName, c.ParentKey.SqlName))
+		buffer.WriteString(fmt.Sprintf("DELETE FROM %s WHERE %s = %s", q(c.TableName), q(c.ParentKey.SqlName), d.Placeholder(1)))
 	} else {
 		open := 1
-		buffer.WriteString(fmt.Sprintf("DELETE FROM %s WHERE %s IN (", c.TableName, c.ParentKey.SqlName))
+		buffer.WriteString(fmt.Sprintf("DELETE FROM %s WHERE %s IN (", q(c.TableName), q(c.ParentKey.SqlName)))
 		for i := len(tablePath) - 1; i >= 0; i-- {
 			tbl := tablePath[i]
-			if i > 1 {
+			if i > 0 {
 				open++
-				buffer.WriteString(fmt.Sprintf("SELECT %s FROM %s WHERE %s IN (", tbl.PrimaryKey.SqlName, tbl.TableName, tbl.ParentKey.SqlName))
+				buffer.WriteString(fmt.Sprintf("SELECT %s FROM %s WHERE %s IN (", q(tbl.PrimaryKey.SqlName), q(tbl.TableName), q(tbl.ParentKey.SqlName)))
 
 			} else {
-				buffer.WriteString(fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", tbl.PrimaryKey.SqlName, tbl.TableName, tbl.ParentKey.SqlName))
+				buffer.WriteString(fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s", q(tbl.PrimaryKey.SqlName), q(tbl.TableName), q(tbl.ParentKey.SqlName), d.Placeholder(1)))
 			}
 
 		}
@@ -220,6 +206,28 @@ func (c *ChildTable) getDeleteQuery(tablePath []*ChildTable) string {
 	return buffer.String()
 }
 
-func (e *Entity) getDeleteQuery() string {
-	return fmt.Sprintf("DELETE FROM %s WHERE %s = ?", e.TableName, e.PrimaryKey.SqlName)
+func (e *Entity) getDeleteQuery(d Dialect) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s = %s", d.QuoteIdentifier(e.TableName), d.QuoteIdentifier(e.PrimaryKey.SqlName), d.Placeholder(1))
+}
+
+func (rel *ManyToMany) getSelectQuery(d Dialect) string {
+	q := d.QuoteIdentifier
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s", q(rel.RelatedKey.SqlName), q(rel.TableName), q(rel.OwnerKey.SqlName), d.Placeholder(1))
+}
+
+func (rel *ManyToMany) getInsertQuery(d Dialect) string {
+	q := d.QuoteIdentifier
+	return fmt.Sprintf("INSERT INTO %s(%s, %s) VALUES (%s, %s)", q(rel.TableName), q(rel.OwnerKey.SqlName), q(rel.RelatedKey.SqlName),
+		d.Placeholder(1), d.Placeholder(2))
+}
+
+func (rel *ManyToMany) getRemoveQuery(d Dialect) string {
+	q := d.QuoteIdentifier
+	return fmt.Sprintf("DELETE FROM %s WHERE %s=%s AND %s=%s", q(rel.TableName), q(rel.OwnerKey.SqlName), d.Placeholder(1),
+		q(rel.RelatedKey.SqlName), d.Placeholder(2))
+}
+
+func (rel *ManyToMany) getDeleteQuery(d Dialect) string {
+	q := d.QuoteIdentifier
+	return fmt.Sprintf("DELETE FROM %s WHERE %s = %s", q(rel.TableName), q(rel.OwnerKey.SqlName), d.Placeholder(1))
 }
@@ -0,0 +1,182 @@
+package gorb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type (
+	vlMoney struct {
+		Cents    int64
+		Currency string
+	}
+
+	vlStatus uint8
+
+	vlOrder struct {
+		Id       int64    `gorb:"id,pk"`
+		Total    vlMoney  `gorb:"total,type=String,:20"`
+		Shipping *vlMoney `gorb:"shipping,type=string,:20"`
+		Status   vlStatus `gorb:"status,default=1"`
+	}
+)
+
+func (m vlMoney) Value() (driver.Value, error) {
+	return fmt.Sprintf("%d %s", m.Cents, m.Currency), nil
+}
+
+func (m *vlMoney) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("Cannot scan money from %T", value)
+	}
+	_, e := fmt.Sscanf(s, "%d %s", &m.Cents, &m.Currency)
+	return e
+}
+
+func (s vlStatus) Value() (driver.Value, error) {
+	return int64(s), nil
+}
+
+func (s *vlStatus) Scan(value interface{}) error {
+	i, e := parseIntRange(value, 0, 3)
+	*s = vlStatus(i)
+	return e
+}
+
+func TestValuerFields(t *testing.T) {
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(vlOrder{}), "vl_order")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if f := ent.FieldByName("Total"); f.DataType != String || !f.IsValuer || f.Precision != 20 {
+		t.Error(f)
+	}
+	if f := ent.FieldByName("Status"); f.DataType != Int8 || !f.IsUnsigned || !f.IsValuer {
+		t.Error(f)
+	}
+
+	type vlUntyped struct {
+		Id    int64   `gorb:"id,pk"`
+		Total vlMoney `gorb:"total"`
+	}
+	if _, e = m.RegisterEntity(reflect.TypeOf(vlUntyped{}), "vl_untyped"); e == nil || !strings.Contains(e.Error(), "type=") {
+		t.Error("missing type accepted", e)
+	}
+
+	var o vlOrder
+	if e = (&gorbScanner{ptr: &o.Total}).Scan([]byte("1250 EUR")); e != nil || o.Total.Cents != 1250 || o.Total.Currency != "EUR" {
+		t.Error(e, o.Total)
+	}
+	if e = (&gorbScanner{ptr: &o.Shipping}).Scan("300 EUR"); e != nil || o.Shipping == nil || o.Shipping.Cents != 300 {
+		t.Error(e, o.Shipping)
+	}
+	if (&gorbScanner{ptr: &o.Status}).Scan(int64(7)) == nil {
+		t.Error("scanner error ignored")
+	}
+
+	cl, e := m.EntityClone(&o)
+	if e != nil {
+		t.Fatal(e)
+	}
+	oc := cl.(*vlOrder)
+	if oc.Shipping == o.Shipping || *oc.Shipping != *o.Shipping || oc.Total != o.Total {
+		t.Error("clone", oc)
+	}
+
+	js, _ := m.EntityJsonGet(&o, nil)
+	if !strings.Contains(string(js), `"Total":"1250 EUR"`) || !strings.Contains(string(js), `"Shipping":"300 EUR"`) {
+		t.Error(string(js))
+	}
+	o.Status = 2
+	js, _ = m.EntityJsonGet(&o, oc)
+	if string(js) != `{"Id":0,"Status":2}` {
+		t.Error(string(js))
+	}
+	if e = m.EntityJsonApply(oc, []byte(`{"Shipping": null, "Status": 3, "Total": "99 USD"}`)); e != nil {
+		t.Fatal(e)
+	}
+	if oc.Shipping != nil || oc.Status != 3 || oc.Total.Currency != "USD" {
+		t.Error(oc)
+	}
+}
+
+type (
+	vlOptions struct {
+		Retries int      `json:"retries"`
+		Hosts   []string `json:"hosts"`
+	}
+
+	vlService struct {
+		Id      int64             `gorb:"id,pk"`
+		Labels  map[string]string `gorb:"labels,json"`
+		Options *vlOptions        `gorb:"options,json"`
+		Tags    []string          `gorb:"tags,json,null"`
+		Raw     string            `gorb:"raw,json"`
+	}
+)
+
+func TestJsonDocumentFields(t *testing.T) {
+	var m GorbManager
+	ent, e := m.RegisterEntity(reflect.TypeOf(vlService{}), "vl_service")
+	if e != nil {
+		t.Fatal(e)
+	}
+	ts := (&SchemaUpgrader{}).GetSchemaForEntity(ent)
+	if d := mySqlColumnDefinition(ts.ColumnByName("labels")); d != "labels Json Not Null" {
+		t.Error(d)
+	}
+	if d := sqliteColumnDefinition(ts.ColumnByName("options")); d != "options JSON_TEXT NULL" {
+		t.Error(d)
+	}
+	if f := ent.FieldByName("Raw"); f.DataType != Json || f.isJsonDocument() {
+		t.Error("raw document", f)
+	}
+
+	s := vlService{Labels: map[string]string{"env": "prod"}, Options: &vlOptions{Retries: 3, Hosts: []string{"a", "b"}}}
+	doc, e := marshalJsonDocument(reflect.ValueOf(s.Options), true)
+	if e != nil || doc != `{"retries":3,"hosts":["a","b"]}` {
+		t.Error(doc, e)
+	}
+	if doc, _ = marshalJsonDocument(reflect.ValueOf(s.Tags), true); doc != nil {
+		t.Error("nil slice of nullable field", doc)
+	}
+	if doc, _ = marshalJsonDocument(reflect.ValueOf(map[string]string(nil)), false); doc != "null" {
+		t.Error("nil map of not null field", doc)
+	}
+
+	var scanned vlService
+	scanned.Labels = map[string]string{"stale": "1"}
+	if e = (&gorbScanner{ptr: &scanned.Labels, isJson: true}).Scan([]byte(`{"env":"dev"}`)); e != nil || len(scanned.Labels) != 1 || scanned.Labels["env"] != "dev" {
+		t.Error(e, scanned.Labels)
+	}
+	if e = (&gorbScanner{ptr: &scanned.Options, isJson: true}).Scan(`{"retries":1}`); e != nil || scanned.Options.Retries != 1 {
+		t.Error(e, scanned.Options)
+	}
+
+	cl, _ := m.EntityClone(&s)
+	old := cl.(*vlService)
+	s.Options.Hosts[0] = "c"
+	if old.Options.Hosts[0] != "a" {
+		t.Error("clone shares document")
+	}
+	js, _ := m.EntityJsonGet(&s, old)
+	if string(js) != `{"Id":0,"Options":{"retries":3,"hosts":["c","b"]}}` {
+		t.Error(string(js))
+	}
+	if e = m.EntityJsonApply(old, []byte(`{"Labels": {"env": "test"}, "Options": null, "Tags": ["x"]}`)); e != nil {
+		t.Fatal(e)
+	}
+	if old.Labels["env"] != "test" || old.Options != nil || len(old.Tags) != 1 {
+		t.Error(old)
+	}
+}